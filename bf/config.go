@@ -0,0 +1,64 @@
+package bf
+
+import "fmt"
+
+// Config contains the cell, tape, and end-of-file semantics of a
+// Brainfuck program. The zero value has unbounded cells, an unbounded
+// tape without bounds checking, and stores -1 at EOF.
+type Config struct {
+	CellBits    uint    // Width of wrapping cells: 8, 16, or 32; 0 for unbounded cells
+	TapeLen     uint    // Number of cells on the tape; 0 for unbounded
+	CheckBounds bool    // Exit with an error when a cell off the tape is accessed
+	EOF         EOFMode // Behavior of read at end of input
+}
+
+// DefaultTapeLen is the conventional Brainfuck tape length.
+const DefaultTapeLen = 30000
+
+// EOFMode is the behavior of read at end of input.
+type EOFMode uint8
+
+// EOF modes.
+const (
+	EOFMinusOne  EOFMode = iota // Store -1, wrapped to the cell width
+	EOFZero                     // Store 0
+	EOFUnchanged                // Leave the cell unchanged
+)
+
+var eofModeNames = []string{"-1", "0", "unchanged"}
+
+// ParseEOFMode looks up an EOF mode by name.
+func ParseEOFMode(name string) (EOFMode, error) {
+	for mode, modeName := range eofModeNames {
+		if name == modeName {
+			return EOFMode(mode), nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized EOF mode: %s", name)
+}
+
+// EOFModeNames returns the names of all EOF modes.
+func EOFModeNames() []string {
+	return append([]string{}, eofModeNames...)
+}
+
+func (mode EOFMode) String() string {
+	if int(mode) < len(eofModeNames) {
+		return eofModeNames[mode]
+	}
+	return fmt.Sprintf("EOFMode(%d)", mode)
+}
+
+// Validate checks that the cell width is supported.
+func (c Config) Validate() error {
+	switch c.CellBits {
+	case 0, 8, 16, 32:
+		return nil
+	}
+	return fmt.Errorf("unsupported cell width: %d bits", c.CellBits)
+}
+
+// wraps returns whether cells wrap on overflow.
+func (c Config) wraps() bool {
+	return c.CellBits != 0
+}
@@ -0,0 +1,98 @@
+package bf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatStyle is the layout of formatted Brainfuck source.
+type FormatStyle uint8
+
+// Format styles.
+const (
+	Canonical FormatStyle = iota // Instructions only, wrapped at 80 columns
+	Minified                     // Instructions only, on a single line
+	Indented                     // Runs on separate lines, indented by loop depth
+)
+
+var formatStyleNames = []string{"canonical", "minified", "indented"}
+
+func (style FormatStyle) String() string {
+	if int(style) < len(formatStyleNames) {
+		return formatStyleNames[style]
+	}
+	return fmt.Sprintf("FormatStyle(%d)", style)
+}
+
+const canonicalWidth = 80
+
+// Format formats the program in a syntax with the given style. Comments
+// are dropped. Embedded input follows a separator, when the syntax has
+// one.
+func (p *Program) Format(s *Syntax, style FormatStyle) string {
+	// Words are separated by spaces unless all spellings are one
+	// character.
+	sep := ""
+	for _, spell := range s.Spellings {
+		if len(spell) != 1 {
+			sep = " "
+			break
+		}
+	}
+	var b strings.Builder
+	switch style {
+	case Canonical:
+		col := 0
+		for i, tok := range p.Tokens {
+			spell := s.Spellings[tok.Type]
+			if i != 0 {
+				if col+len(sep)+len(spell) > canonicalWidth {
+					b.WriteByte('\n')
+					col = 0
+				} else {
+					b.WriteString(sep)
+					col += len(sep)
+				}
+			}
+			b.WriteString(spell)
+			col += len(spell)
+		}
+	case Minified:
+		for i, tok := range p.Tokens {
+			if i != 0 {
+				b.WriteString(sep)
+			}
+			b.WriteString(s.Spellings[tok.Type])
+		}
+	case Indented:
+		indent := "  "
+		indentLevel := 0
+		var prev Type
+		for i, tok := range p.Tokens {
+			if tok.Type == EndBracket && indentLevel > 0 {
+				indentLevel--
+			}
+			if (prev != tok.Type && i != 0) || tok.Type == Bracket || tok.Type == EndBracket {
+				b.WriteByte('\n')
+				b.WriteString(strings.Repeat(indent, indentLevel))
+			} else if i != 0 {
+				b.WriteString(sep)
+			}
+			if tok.Type == Bracket {
+				indentLevel++
+			}
+			b.WriteString(s.Spellings[tok.Type])
+			prev = tok.Type
+		}
+	default:
+		panic(fmt.Sprintf("bf: unrecognized format style: %v", style))
+	}
+	if p.Input != nil && s.Separator != "" {
+		if style != Minified && len(p.Tokens) != 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString(s.Separator)
+		b.Write(p.Input)
+	}
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package bf
+
+import (
+	"go/token"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	src := "Print a: ++++++++[>++++++++++++<-]>+. done"
+	tests := []struct {
+		Syntax *Syntax
+		Style  FormatStyle
+		Want   string
+	}{
+		{Brainfuck, Minified, "++++++++[>++++++++++++<-]>+."},
+		{Brainfuck, Canonical, "++++++++[>++++++++++++<-]>+."},
+		{Brainfuck, Indented, "++++++++\n[\n  >\n  ++++++++++++\n  <\n  -\n]\n>\n+\n."},
+		{Ook, Minified, strings.Repeat("Ook. Ook. ", 8) + "Ook! Ook? Ook. Ook? " +
+			strings.Repeat("Ook. Ook. ", 12) + "Ook? Ook. Ook! Ook! Ook? Ook! Ook. Ook? Ook. Ook. Ook! Ook."},
+	}
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src), Brainfuck)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := &Program{Tokens: tokens, File: file}
+	for _, test := range tests {
+		if got := p.Format(test.Syntax, test.Style); got != test.Want {
+			t.Errorf("%s %v: got:\n%s\nwant:\n%s", test.Syntax.Name, test.Style, got, test.Want)
+		}
+	}
+}
+
+func TestFormatCanonicalWrap(t *testing.T) {
+	src := strings.Repeat("+", 100) + "!input"
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	l := NewLexer(file, []byte(src), Brainfuck)
+	l.Separator = true
+	p, err := l.LexProgram()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := strings.Repeat("+", 80) + "\n" + strings.Repeat("+", 20) + "\n!input"
+	if got := p.Format(Brainfuck, Canonical); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
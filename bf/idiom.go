@@ -0,0 +1,136 @@
+package bf
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+)
+
+// op is a Brainfuck operation with runs folded and loop idioms
+// recognized.
+type op struct {
+	Kind  opKind
+	N     int64     // Count for moves and adds; step of current cell for clear and multiply loops
+	Terms []mulTerm // Terms for multiply loops
+	Body  []op      // Body for loops
+	Pos   token.Pos
+	End   token.Pos // Position of end bracket for loops
+}
+
+type opKind uint8
+
+const (
+	moveOp  opKind = iota + 1 // Move pointer by N
+	addOp                     // Add N to current cell
+	printOp                   // Print current cell
+	readOp                    // Read into current cell
+	loopOp                    // Loop while current cell is non-zero
+	clearOp                   // Set current cell to zero; [-]
+	mulOp                     // Add multiples of current cell to other cells, then clear it; [->+>++<<]
+	debugOp                   // Dump the tape
+)
+
+// mulTerm adds Factor times the current cell to the cell at Offset.
+type mulTerm struct {
+	Offset int64
+	Factor int64
+}
+
+// parseOps folds runs of moves and adds and recognizes clear and
+// multiply loops. Clear and multiply loops are only recognized when
+// they decrement the current cell by one each iteration, so they
+// terminate exactly when the cell is non-negative, or, when cells wrap,
+// when they increment it by one. With unbounded cells, a negative cell
+// is left to the lowering, which branches to an infinite loop.
+func parseOps(tokens []*Token, wrap bool) ([]op, []error) {
+	var errs []error
+	stack := [][]op{nil}
+	var brackets []*Token
+	for _, tok := range tokens {
+		ops := &stack[len(stack)-1]
+		switch tok.Type {
+		case IncPtr, DecPtr:
+			appendRun(ops, moveOp, tok)
+		case IncData, DecData:
+			appendRun(ops, addOp, tok)
+		case Print:
+			*ops = append(*ops, op{Kind: printOp, Pos: tok.Pos})
+		case Read:
+			*ops = append(*ops, op{Kind: readOp, Pos: tok.Pos})
+		case Debug:
+			*ops = append(*ops, op{Kind: debugOp, Pos: tok.Pos})
+		case Bracket:
+			stack = append(stack, nil)
+			brackets = append(brackets, tok)
+		case EndBracket:
+			if len(brackets) == 0 {
+				errs = append(errs, fmt.Errorf("End bracket not matched at %v", tok.Pos))
+				continue
+			}
+			body := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			open := brackets[len(brackets)-1]
+			brackets = brackets[:len(brackets)-1]
+			loop := op{Kind: loopOp, Body: body, Pos: open.Pos, End: tok.Pos}
+			recognizeLoop(&loop, wrap)
+			stack[len(stack)-1] = append(stack[len(stack)-1], loop)
+		}
+	}
+	for _, bracket := range brackets {
+		errs = append(errs, fmt.Errorf("Bracket not matched at %v", bracket.Pos))
+	}
+	return stack[0], errs
+}
+
+// appendRun appends a move or add, folding it into a preceding op of
+// the same kind.
+func appendRun(ops *[]op, kind opKind, tok *Token) {
+	n := int64(1)
+	if tok.Type == DecPtr || tok.Type == DecData {
+		n = -1
+	}
+	if l := len(*ops); l != 0 && (*ops)[l-1].Kind == kind {
+		(*ops)[l-1].N += n
+		if (*ops)[l-1].N == 0 {
+			*ops = (*ops)[:l-1]
+		}
+		return
+	}
+	*ops = append(*ops, op{Kind: kind, N: n, Pos: tok.Pos})
+}
+
+// recognizeLoop converts a loop to a clear or multiply loop when its
+// body only moves and adds, returns to the starting cell, and steps
+// the starting cell by one towards zero.
+func recognizeLoop(loop *op, wrap bool) {
+	var off int64
+	deltas := make(map[int64]int64)
+	for _, o := range loop.Body {
+		switch o.Kind {
+		case moveOp:
+			off += o.N
+		case addOp:
+			deltas[off] += o.N
+		default:
+			return
+		}
+	}
+	step := deltas[0]
+	if off != 0 || step != -1 && !(wrap && step == 1) {
+		return
+	}
+	delete(deltas, 0)
+	for offset, factor := range deltas {
+		if factor != 0 {
+			loop.Terms = append(loop.Terms, mulTerm{offset, factor})
+		}
+	}
+	sort.Slice(loop.Terms, func(i, j int) bool { return loop.Terms[i].Offset < loop.Terms[j].Offset })
+	loop.Body = nil
+	loop.N = step
+	if len(loop.Terms) == 0 {
+		loop.Kind = clearOp
+	} else {
+		loop.Kind = mulOp
+	}
+}
@@ -1,66 +1,69 @@
 package bf
 
 import (
+	"bytes"
 	"go/token"
 	"io"
 )
 
-// Lexer scans tokens in Brainfuck source.
+// Lexer scans tokens in Brainfuck source or in the source of an
+// isomorph with a different syntax. Text that is not a token is
+// ignored.
 type Lexer struct {
-	file   *token.File
-	src    []byte
-	offset int
+	Debug     bool // Lex debug dump tokens (# in Brainfuck)
+	Separator bool // End code at the separator (! in Brainfuck) and take the rest as input
+
+	file      *token.File
+	src       []byte
+	offset    int
+	syntax    *Syntax
+	spellings []spelling
+	input     []byte
 }
 
-// NewLexer constructs a Brainfuck lexer.
-func NewLexer(file *token.File, src []byte) *Lexer {
+// NewLexer constructs a lexer for a Brainfuck syntax.
+func NewLexer(file *token.File, src []byte, syntax *Syntax) *Lexer {
 	return &Lexer{
-		file:   file,
-		src:    src,
-		offset: 0,
+		file:      file,
+		src:       src,
+		offset:    0,
+		syntax:    syntax,
+		spellings: syntax.spellings(),
 	}
 }
 
-// NextToken scans a single Brainfuck token.
+// NextToken scans a single token, preferring the longest spelling.
 func (l *Lexer) NextToken() (*Token, error) {
 	for l.offset < len(l.src) {
-		var typ Type
-		switch l.src[l.offset] {
-		case '>':
-			typ = IncPtr
-		case '<':
-			typ = DecPtr
-		case '+':
-			typ = IncData
-		case '-':
-			typ = DecData
-		case '.':
-			typ = Print
-		case ',':
-			typ = Read
-		case '[':
-			typ = Bracket
-		case ']':
-			typ = EndBracket
-		default:
-			l.offset++
-			continue
+		if l.Separator && l.syntax.Separator != "" &&
+			bytes.HasPrefix(l.src[l.offset:], []byte(l.syntax.Separator)) {
+			l.input = l.src[l.offset+len(l.syntax.Separator):]
+			l.offset = len(l.src)
+			break
+		}
+		for _, spell := range l.spellings {
+			if spell.Type == Debug && !l.Debug {
+				continue
+			}
+			if n := spell.match(l.src[l.offset:]); n != -1 {
+				tok := &Token{spell.Type, l.file.Pos(l.offset)}
+				l.offset += n
+				return tok, nil
+			}
 		}
-		tok := &Token{typ, l.file.Pos(l.offset)}
 		l.offset++
-		return tok, nil
 	}
 	return nil, io.EOF
 }
 
-// LexTokens scans a Brainfuck source files into tokens.
-func LexTokens(file *token.File, src []byte) ([]*Token, error) {
-	l := NewLexer(file, src)
+// LexProgram scans all remaining tokens and embedded input into a
+// program.
+func (l *Lexer) LexProgram() (*Program, error) {
 	var tokens []*Token
 	for {
 		tok, err := l.NextToken()
 		if err == io.EOF {
-			return tokens, nil
+			return &Program{Tokens: tokens, File: l.file, Input: l.input}, nil
 		}
 		if err != nil {
 			return nil, err
@@ -68,3 +71,12 @@ func LexTokens(file *token.File, src []byte) ([]*Token, error) {
 		tokens = append(tokens, tok)
 	}
 }
+
+// LexTokens scans a source file in a Brainfuck syntax into tokens.
+func LexTokens(file *token.File, src []byte, syntax *Syntax) ([]*Token, error) {
+	p, err := NewLexer(file, src, syntax).LexProgram()
+	if err != nil {
+		return nil, err
+	}
+	return p.Tokens, nil
+}
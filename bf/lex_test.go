@@ -0,0 +1,80 @@
+package bf
+
+import (
+	"go/token"
+	"reflect"
+	"testing"
+)
+
+func TestLexSyntax(t *testing.T) {
+	tests := []struct {
+		Syntax *Syntax
+		Src    string
+		Types  []Type
+	}{
+		{Brainfuck, "+[>.<-] comment,", []Type{IncData, Bracket, IncPtr, Print, DecPtr, DecData, EndBracket, Read}},
+		{Ook, "Ook. Ook?\nOok! Ook?Ook? Ook! Ook.\tOok.", []Type{IncPtr, Bracket, EndBracket, IncData}},
+		{Blub, "Blub! Blub. Blub. Blub!", []Type{Print, Read}},
+		{Pikalang, "pi pipi pikachu pichu pikapi pika chu ka", []Type{IncData, IncPtr, Print, DecPtr, Read, Bracket, EndBracket, DecData}},
+	}
+	for _, test := range tests {
+		file := token.NewFileSet().AddFile(test.Syntax.Name, -1, len(test.Src))
+		tokens, err := LexTokens(file, []byte(test.Src), test.Syntax)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.Syntax.Name, err)
+			continue
+		}
+		types := make([]Type, len(tokens))
+		for i, tok := range tokens {
+			types[i] = tok.Type
+		}
+		if !reflect.DeepEqual(types, test.Types) {
+			t.Errorf("%s: got %v, want %v", test.Syntax.Name, types, test.Types)
+		}
+	}
+}
+
+func TestLookupExt(t *testing.T) {
+	tests := []struct {
+		Filename string
+		Syntax   *Syntax
+	}{
+		{"hello.bf", Brainfuck},
+		{"programs/hello.ook", Ook},
+		{"hello.pokeball", Pikalang},
+		{"hello.ws", nil},
+	}
+	for _, test := range tests {
+		s, ok := LookupExt(test.Filename)
+		if s != test.Syntax || ok != (test.Syntax != nil) {
+			t.Errorf("LookupExt(%q) = %v, %t", test.Filename, s, ok)
+		}
+	}
+}
+
+func TestLexExtensions(t *testing.T) {
+	src := "+#.!#,\n"
+	for _, ext := range []bool{false, true} {
+		file := token.NewFileSet().AddFile("test", -1, len(src))
+		l := NewLexer(file, []byte(src), Brainfuck)
+		l.Debug, l.Separator = ext, ext
+		p, err := l.LexProgram()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		types := make([]Type, len(p.Tokens))
+		for i, tok := range p.Tokens {
+			types[i] = tok.Type
+		}
+		wantTypes := []Type{IncData, Print, Read}
+		var wantInput []byte
+		if ext {
+			wantTypes = []Type{IncData, Debug, Print}
+			wantInput = []byte("#,\n")
+		}
+		if !reflect.DeepEqual(types, wantTypes) || !reflect.DeepEqual(p.Input, wantInput) {
+			t.Errorf("extensions %t: got %v and input %q, want %v and input %q",
+				ext, types, p.Input, wantTypes, wantInput)
+		}
+	}
+}
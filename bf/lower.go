@@ -1,87 +1,77 @@
 package bf
 
 import (
-	"fmt"
 	"go/token"
 	"math/big"
 
 	"github.com/andrewarchi/nebula/ir"
 )
 
-type bracketBlock struct {
-	Block *ir.BasicBlock
-	Pos   token.Pos
+// Heap layout of a lowered program. The data pointer is stored in heap
+// cell 0. With embedded input, the position of the next input byte is
+// stored in cell 1 and the input begins at cell 2. The tape follows.
+const (
+	dataPtrAddr  = 0
+	inputPosAddr = 1
+	inputAddr    = 2
+)
+
+// irBuilder lowers Brainfuck operations to IR. Within a block, the data
+// pointer is loaded once and moves are tracked as an offset, which is
+// stored back before control flow.
+type irBuilder struct {
+	*ir.Builder
+	config  Config
+	input   []byte
+	base    int64 // Heap address of first cell
+	bound   uint  // Heap bound of tape, or 0 when unbounded
+	dataPtr ir.Value
+	ptr     ir.Value // Data pointer at start of offset, if loaded
+	off     int64    // Offset of current cell from ptr
+	checked bool     // Whether offsets lo through hi from ptr are checked
+	lo, hi  int64
+	hangs   []*ir.JmpCondTerm // Branches for clear and multiply loops that never terminate
 }
 
-// LowerIR lowers a Brainfuck program to Nebula IR in SSA form.
+// LowerIR lowers a Brainfuck program to Nebula IR in SSA form. Runs of
+// moves and adds are folded and clear and multiply loops are lowered
+// to straight-line arithmetic. Cells, the tape, and EOF follow the
+// semantics in p.Config.
 func (p *Program) LowerIR() (*ir.Program, []error) {
-	b := ir.NewBuilder(p.File)
+	if err := p.Config.Validate(); err != nil {
+		return nil, []error{err}
+	}
+	ops, errs := parseOps(p.Tokens, p.Config.wraps())
+	b := &irBuilder{
+		Builder: ir.NewBuilder(p.File),
+		config:  p.Config,
+		input:   p.Input,
+		base:    p.tapeBase(),
+		bound:   p.HeapBound(),
+		dataPtr: ir.NewIntConst(big.NewInt(dataPtrAddr), token.NoPos),
+	}
 	b.SetCurrentBlock(b.CreateBlock())
-	dataPtr := ir.NewIntConst(big.NewInt(0), token.NoPos)
-	one := ir.NewIntConst(big.NewInt(1), token.NoPos)
-	b.CreateStoreHeapStmt(dataPtr, one, token.NoPos)
-	var bracketStack []bracketBlock
-	var errs []error
-	for _, tok := range p.Tokens {
-		switch tok.Type {
-		case IncPtr:
-			load := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			inc := b.CreateBinaryExpr(ir.Add, load, one, tok.Pos)
-			b.CreateStoreHeapStmt(dataPtr, inc, tok.Pos)
-		case DecPtr:
-			load := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			dec := b.CreateBinaryExpr(ir.Sub, load, one, tok.Pos)
-			b.CreateStoreHeapStmt(dataPtr, dec, tok.Pos)
-		case IncData:
-			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			val := b.CreateLoadHeapExpr(data, tok.Pos)
-			inc := b.CreateBinaryExpr(ir.Add, val, one, tok.Pos)
-			b.CreateStoreHeapStmt(data, inc, tok.Pos)
-		case DecData:
-			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			val := b.CreateLoadHeapExpr(data, tok.Pos)
-			dec := b.CreateBinaryExpr(ir.Sub, val, one, tok.Pos)
-			b.CreateStoreHeapStmt(data, dec, tok.Pos)
-		case Print:
-			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			val := b.CreateLoadHeapExpr(data, tok.Pos)
-			b.CreatePrintStmt(ir.PrintByte, val, tok.Pos)
-		case Read:
-			val := b.CreateReadExpr(ir.ReadByte, tok.Pos)
-			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			b.CreateStoreHeapStmt(data, val, tok.Pos)
-		case Bracket:
-			if len(b.CurrentBlock().Nodes) != 0 {
-				head := b.CreateBlock()
-				b.CreateJmpTerm(ir.Fallthrough, head, tok.Pos)
-				b.SetCurrentBlock(head)
-			}
-			data := b.CreateLoadHeapExpr(dataPtr, tok.Pos)
-			val := b.CreateLoadHeapExpr(data, tok.Pos)
-			next := b.CreateBlock()
-			b.CreateJmpCondTerm(ir.Jz, val, nil, next, tok.Pos)
-			bracketStack = append(bracketStack, bracketBlock{b.CurrentBlock(), tok.Pos})
-			b.SetCurrentBlock(next)
-		case EndBracket:
-			if len(bracketStack) == 0 {
-				errs = append(errs, fmt.Errorf("End bracket not matched at %v", tok.Pos))
-				continue
-			}
-			head := bracketStack[len(bracketStack)-1].Block
-			bracketStack = bracketStack[:len(bracketStack)-1]
-			next := b.CreateBlock()
-			head.Terminator.(*ir.JmpCondTerm).Succs()[0] = next
-			b.CreateJmpTerm(ir.Jmp, head, tok.Pos)
-			b.SetCurrentBlock(next)
+	if p.Input != nil {
+		b.CreateStoreHeapStmt(b.intConst(inputPosAddr, token.NoPos), b.intConst(0, token.NoPos), token.NoPos)
+		for i, c := range p.Input {
+			b.CreateStoreHeapStmt(b.intConst(inputAddr+int64(i), token.NoPos), b.intConst(int64(c), token.NoPos), token.NoPos)
 		}
 	}
+	b.ptr = b.intConst(b.base, token.NoPos)
+	b.CreateStoreHeapStmt(b.dataPtr, b.ptr, token.NoPos)
+	b.lowerOps(ops)
 	exitPos := token.NoPos
 	if len(p.Tokens) != 0 {
 		exitPos = p.Tokens[len(p.Tokens)-1].Pos
 	}
 	b.CreateExitTerm(exitPos)
-	for _, bracket := range bracketStack {
-		errs = append(errs, fmt.Errorf("Bracket not matched at %v", bracket.Pos))
+	if len(b.hangs) != 0 {
+		hang := b.CreateBlock()
+		b.SetCurrentBlock(hang)
+		b.CreateJmpTerm(ir.Jmp, hang, exitPos)
+		for _, jn := range b.hangs {
+			jn.Succs()[0] = hang
+		}
 	}
 	ssa, err := b.Program()
 	if err != nil {
@@ -89,3 +79,248 @@ func (p *Program) LowerIR() (*ir.Program, []error) {
 	}
 	return ssa, errs
 }
+
+func (b *irBuilder) lowerOps(ops []op) {
+	for _, o := range ops {
+		switch o.Kind {
+		case moveOp:
+			b.off += o.N
+		case addOp:
+			addr := b.cellAddr(0, o.Pos)
+			val := b.CreateLoadHeapExpr(addr, o.Pos)
+			b.CreateStoreHeapStmt(addr, b.wrap(b.addConst(val, o.N, o.Pos), o.Pos), o.Pos)
+		case printOp:
+			val := b.CreateLoadHeapExpr(b.cellAddr(0, o.Pos), o.Pos)
+			b.CreatePrintStmt(ir.PrintByte, val, o.Pos)
+		case readOp:
+			b.lowerRead(o)
+		case clearOp:
+			addr := b.cellAddr(0, o.Pos)
+			if !b.config.wraps() {
+				b.hangIfNegative(b.CreateLoadHeapExpr(addr, o.Pos), o.Pos)
+			}
+			b.CreateStoreHeapStmt(addr, b.intConst(0, o.Pos), o.Pos)
+		case mulOp:
+			addr := b.cellAddr(0, o.Pos)
+			var count ir.Value = b.CreateLoadHeapExpr(addr, o.Pos)
+			termAddrs := make([]ir.Value, len(o.Terms))
+			for i, term := range o.Terms {
+				termAddrs[i] = b.cellAddr(term.Offset, o.Pos)
+			}
+			if !b.config.wraps() {
+				b.hangIfNegative(count, o.Pos)
+			} else if o.N > 0 { // wrapping increment loop runs until overflow
+				count = b.wrap(b.CreateUnaryExpr(ir.Neg, count, o.Pos), o.Pos)
+			}
+			for i, term := range o.Terms {
+				termAddr := termAddrs[i]
+				termVal := b.CreateLoadHeapExpr(termAddr, o.Pos)
+				var sum ir.Value
+				switch term.Factor {
+				case 1:
+					sum = b.CreateBinaryExpr(ir.Add, termVal, count, o.Pos)
+				case -1:
+					sum = b.CreateBinaryExpr(ir.Sub, termVal, count, o.Pos)
+				default:
+					prod := b.CreateBinaryExpr(ir.Mul, count, b.intConst(term.Factor, o.Pos), o.Pos)
+					sum = b.CreateBinaryExpr(ir.Add, termVal, prod, o.Pos)
+				}
+				b.CreateStoreHeapStmt(termAddr, b.wrap(sum, o.Pos), o.Pos)
+			}
+			b.CreateStoreHeapStmt(addr, b.intConst(0, o.Pos), o.Pos)
+		case loopOp:
+			b.lowerLoop(o)
+		case debugOp:
+			b.syncPtr(o.Pos)
+			b.CreateDebugStmt(ir.DumpHeap, o.Pos)
+		}
+	}
+}
+
+// lowerRead lowers a read. The runtime reads a negative value at EOF,
+// which, unless -1 is stored, branches around the store.
+func (b *irBuilder) lowerRead(read op) {
+	addr := b.cellAddr(0, read.Pos)
+	if b.input != nil {
+		b.lowerInputRead(addr, read.Pos)
+		return
+	}
+	val := b.CreateReadExpr(ir.ReadByte, read.Pos)
+	if b.config.EOF == EOFMinusOne {
+		b.CreateStoreHeapStmt(addr, b.wrap(val, read.Pos), read.Pos)
+		return
+	}
+	if b.config.EOF == EOFZero {
+		b.CreateStoreHeapStmt(addr, b.intConst(0, read.Pos), read.Pos)
+	}
+	store := b.CreateBlock()
+	next := b.CreateBlock()
+	b.CreateJmpCondTerm(ir.Jn, val, next, store, read.Pos)
+	b.SetCurrentBlock(store)
+	b.CreateStoreHeapStmt(addr, val, read.Pos)
+	b.CreateJmpTerm(ir.Fallthrough, next, read.Pos)
+	b.SetCurrentBlock(next)
+}
+
+// lowerInputRead lowers a read from the embedded input, rather than
+// from stdin.
+func (b *irBuilder) lowerInputRead(addr ir.Value, pos token.Pos) {
+	posAddr := b.intConst(inputPosAddr, pos)
+	inputPos := b.CreateLoadHeapExpr(posAddr, pos)
+	remaining := b.addConst(inputPos, -int64(len(b.input)), pos)
+	eof := b.CreateBlock()
+	avail := b.CreateBlock()
+	next := b.CreateBlock()
+	b.CreateJmpCondTerm(ir.Jn, remaining, avail, eof, pos)
+
+	b.SetCurrentBlock(eof)
+	switch b.config.EOF {
+	case EOFMinusOne:
+		b.CreateStoreHeapStmt(addr, b.wrap(b.intConst(-1, pos), pos), pos)
+	case EOFZero:
+		b.CreateStoreHeapStmt(addr, b.intConst(0, pos), pos)
+	}
+	b.CreateJmpTerm(ir.Jmp, next, pos)
+
+	b.SetCurrentBlock(avail)
+	val := b.CreateLoadHeapExpr(b.addConst(inputPos, inputAddr, pos), pos)
+	b.CreateStoreHeapStmt(addr, val, pos)
+	b.CreateStoreHeapStmt(posAddr, b.addConst(inputPos, 1, pos), pos)
+	b.CreateJmpTerm(ir.Fallthrough, next, pos)
+	b.SetCurrentBlock(next)
+}
+
+// hangIfNegative branches to an infinite loop when the count of a
+// clear or multiply loop is negative, as the loop would never terminate
+// with unbounded cells. The loaded pointer stays valid, since the next
+// block is only entered from the current block.
+func (b *irBuilder) hangIfNegative(count ir.Value, pos token.Pos) {
+	next := b.CreateBlock()
+	b.hangs = append(b.hangs, b.CreateJmpCondTerm(ir.Jn, count, nil, next, pos))
+	b.SetCurrentBlock(next)
+}
+
+func (b *irBuilder) lowerLoop(loop op) {
+	b.storePtr(loop.Pos)
+	if len(b.CurrentBlock().Nodes) != 0 {
+		head := b.CreateBlock()
+		b.CreateJmpTerm(ir.Fallthrough, head, loop.Pos)
+		b.SetCurrentBlock(head)
+	}
+	head := b.CurrentBlock()
+	val := b.CreateLoadHeapExpr(b.cellAddr(0, loop.Pos), loop.Pos)
+	body := b.CreateBlock()
+	cond := b.CreateJmpCondTerm(ir.Jz, val, nil, body, loop.Pos)
+	b.SetCurrentBlock(body)
+	b.resetPtr()
+	b.lowerOps(loop.Body)
+	b.storePtr(loop.End)
+	next := b.CreateBlock()
+	cond.Succs()[0] = next
+	b.CreateJmpTerm(ir.Jmp, head, loop.End)
+	b.SetCurrentBlock(next)
+	b.resetPtr()
+}
+
+// cellAddr returns the heap address of the cell at an offset from the
+// current cell. Addresses are folded while the pointer is constant.
+func (b *irBuilder) cellAddr(offset int64, pos token.Pos) ir.Value {
+	if b.ptr == nil {
+		b.ptr = b.CreateLoadHeapExpr(b.dataPtr, pos)
+	}
+	offset += b.off
+	var addr ir.Value
+	if c, ok := b.ptr.(*ir.IntConst); ok {
+		addr = ir.NewIntConst(new(big.Int).Add(c.Int(), big.NewInt(offset)), pos)
+		if !b.config.CheckBounds || b.onTape(addr.(*ir.IntConst).Int()) {
+			return addr
+		}
+	} else {
+		addr = b.addConst(b.ptr, offset, pos)
+	}
+	if b.config.CheckBounds && (!b.checked || offset < b.lo || offset > b.hi) {
+		b.CreateAccessHeapStmt(addr, uint(b.base), b.bound, pos)
+		if !b.checked {
+			b.checked, b.lo, b.hi = true, offset, offset
+		} else if offset < b.lo {
+			b.lo = offset
+		} else {
+			b.hi = offset
+		}
+	}
+	return addr
+}
+
+// onTape returns whether a constant address is on the tape.
+func (b *irBuilder) onTape(addr *big.Int) bool {
+	if addr.Cmp(big.NewInt(b.base)) < 0 {
+		return false
+	}
+	return b.bound == 0 || addr.Cmp(big.NewInt(int64(b.bound))) < 0
+}
+
+// storePtr stores the data pointer, when moved, before control flow.
+func (b *irBuilder) storePtr(pos token.Pos) {
+	b.syncPtr(pos)
+	b.resetPtr()
+}
+
+// syncPtr stores the data pointer, when moved, and continues with the
+// stored pointer.
+func (b *irBuilder) syncPtr(pos token.Pos) {
+	if b.off == 0 {
+		return
+	}
+	addr := b.cellAddr(0, pos)
+	b.CreateStoreHeapStmt(b.dataPtr, addr, pos)
+	b.ptr = addr
+	b.lo -= b.off
+	b.hi -= b.off
+	b.off = 0
+}
+
+// resetPtr discards the loaded data pointer at a block boundary.
+func (b *irBuilder) resetPtr() {
+	b.ptr, b.off, b.checked = nil, 0, false
+}
+
+// wrap truncates a cell value to the cell width, if cells wrap.
+func (b *irBuilder) wrap(val ir.Value, pos token.Pos) ir.Value {
+	if !b.config.wraps() {
+		return val
+	}
+	mask := new(big.Int).Lsh(big.NewInt(1), b.config.CellBits)
+	mask.Sub(mask, big.NewInt(1))
+	return b.CreateBinaryExpr(ir.And, val, ir.NewIntConst(mask, pos), pos)
+}
+
+func (b *irBuilder) addConst(val ir.Value, n int64, pos token.Pos) ir.Value {
+	switch {
+	case n > 0:
+		return b.CreateBinaryExpr(ir.Add, val, b.intConst(n, pos), pos)
+	case n < 0:
+		return b.CreateBinaryExpr(ir.Sub, val, b.intConst(-n, pos), pos)
+	}
+	return val
+}
+
+// tapeBase returns the heap address of the first cell.
+func (p *Program) tapeBase() int64 {
+	if p.Input != nil {
+		return inputAddr + int64(len(p.Input))
+	}
+	return dataPtrAddr + 1
+}
+
+// HeapBound returns the exclusive bound of heap addresses used by the
+// lowered program, or 0 when the tape is unbounded.
+func (p *Program) HeapBound() uint {
+	if p.Config.TapeLen == 0 {
+		return 0
+	}
+	return uint(p.tapeBase()) + p.Config.TapeLen
+}
+
+func (b *irBuilder) intConst(n int64, pos token.Pos) *ir.IntConst {
+	return ir.NewIntConst(big.NewInt(n), pos)
+}
@@ -0,0 +1,293 @@
+package bf
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func lowerString(t *testing.T, src string, config Config) string {
+	t.Helper()
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src), Brainfuck)
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+	p, errs := (&Program{Tokens: tokens, File: file, Config: config}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	return ir.NewFormatter().FormatProgram(p)
+}
+
+func TestLowerRuns(t *testing.T) {
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 0 1
+    %0 = loadheap 1
+    %1 = add %0 3
+    storeheap 1 %1
+    %2 = loadheap 3
+    %3 = sub %2 1
+    storeheap 3 %3
+    %4 = loadheap 2
+    printbyte %4
+    %5 = readbyte
+    storeheap 2 %5
+    exit
+`
+	if got := lowerString(t, "+++>>-<.,", Config{}); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerLoopIdioms(t *testing.T) {
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 0 1
+    %0 = loadheap 2
+    jn %0 block_3 block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    storeheap 2 0
+    %1 = loadheap 1
+    jn %1 block_3 block_2
+
+block_2:
+    ; entries: block_1
+    ; callers: <entry>
+    %2 = loadheap 2
+    %3 = add %2 %1
+    storeheap 2 %3
+    %4 = loadheap 3
+    %5 = mul %1 3
+    %6 = add %4 %5
+    storeheap 3 %6
+    storeheap 1 0
+    exit
+
+block_3:
+    ; entries: block_0 block_1 block_3
+    ; callers: <entry>
+    jmp block_3
+`
+	if got := lowerString(t, ">[-]<[->+>+++<<]", Config{}); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerNegativeClear(t *testing.T) {
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 0 1
+    %0 = loadheap 1
+    %1 = sub %0 1
+    storeheap 1 %1
+    %2 = loadheap 1
+    jn %2 block_2 block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    storeheap 1 0
+    %3 = loadheap 1
+    %4 = add %3 1
+    storeheap 1 %4
+    %5 = loadheap 1
+    printbyte %5
+    exit
+
+block_2:
+    ; entries: block_0 block_2
+    ; callers: <entry>
+    jmp block_2
+`
+	if got := lowerString(t, "-[-]+.", Config{}); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerLoop(t *testing.T) {
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 0 1
+    %0 = loadheap 1
+    %1 = add %0 1
+    storeheap 1 %1
+    fallthrough block_1
+
+block_1:
+    ; entries: block_0 block_2
+    ; callers: <entry>
+    %2 = loadheap 0
+    %3 = loadheap %2
+    jz %3 block_3 block_2
+
+block_2:
+    ; entries: block_1
+    ; callers: <entry>
+    %4 = loadheap 0
+    %5 = add %4 1
+    %6 = loadheap %5
+    printbyte %6
+    %7 = loadheap %4
+    %8 = sub %7 1
+    storeheap %4 %8
+    jmp block_1
+
+block_3:
+    ; entries: block_1
+    ; callers: <entry>
+    exit
+`
+	if got := lowerString(t, "+[>.<-]>", Config{}); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerWrap(t *testing.T) {
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 0 1
+    %0 = loadheap 1
+    %1 = sub %0 1
+    %2 = and %1 255
+    storeheap 1 %2
+    %3 = loadheap 1
+    %4 = neg %3
+    %5 = and %4 255
+    %6 = loadheap 2
+    %7 = mul %5 2
+    %8 = add %6 %7
+    %9 = and %8 255
+    storeheap 2 %9
+    storeheap 1 0
+    %10 = readbyte
+    storeheap 1 0
+    jn %10 block_2 block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    storeheap 1 %10
+    fallthrough block_2
+
+block_2:
+    ; entries: block_0 block_1
+    ; callers: <entry>
+    exit
+`
+	config := Config{CellBits: 8, EOF: EOFZero}
+	if got := lowerString(t, "-[+>++<],", config); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerCheckBounds(t *testing.T) {
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 0 1
+    %0 = loadheap 1
+    %1 = add %0 1
+    storeheap 1 %1
+    accessheap 1 5 5
+    %2 = loadheap 5
+    %3 = add %2 1
+    storeheap 5 %3
+    %4 = loadheap 1
+    accessheap 1 5 0
+    jn %4 block_2 block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    %5 = loadheap 0
+    %6 = add %5 %4
+    storeheap 0 %6
+    %7 = loadheap 2
+    %8 = add %7 %4
+    storeheap 2 %8
+    %9 = loadheap 3
+    %10 = sub %9 %4
+    storeheap 3 %10
+    storeheap 1 0
+    exit
+
+block_2:
+    ; entries: block_0 block_2
+    ; callers: <entry>
+    jmp block_2
+`
+	config := Config{TapeLen: 4, CheckBounds: true}
+	if got := lowerString(t, "+>>>>+<<<<[<+>>+>-<<-]", config); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerInvalidConfig(t *testing.T) {
+	file := token.NewFileSet().AddFile("test", -1, 0)
+	p := &Program{File: file, Config: Config{CellBits: 12}}
+	if _, errs := p.LowerIR(); len(errs) != 1 {
+		t.Errorf("got errors %v, want unsupported cell width", errs)
+	}
+}
+
+func TestLowerInput(t *testing.T) {
+	src := ",>#!a"
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	l := NewLexer(file, []byte(src), Brainfuck)
+	l.Debug, l.Separator = true, true
+	p, err := l.LexProgram()
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+	p.Config = Config{EOF: EOFUnchanged}
+	ssa, errs := p.LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 1 0
+    storeheap 2 97
+    storeheap 0 3
+    %0 = loadheap 1
+    %1 = sub %0 1
+    jn %1 block_2 block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    jmp block_3
+
+block_2:
+    ; entries: block_0
+    ; callers: <entry>
+    %2 = add %0 2
+    %3 = loadheap %2
+    storeheap 3 %3
+    %4 = add %0 1
+    storeheap 1 %4
+    fallthrough block_3
+
+block_3:
+    ; entries: block_1 block_2
+    ; callers: <entry>
+    storeheap 0 4
+    dumpheap
+    exit
+`
+	if got := ir.NewFormatter().FormatProgram(ssa); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,166 @@
+package bf
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+)
+
+// Syntax is a table of token spellings for Brainfuck or a Brainfuck
+// isomorph. A space in a spelling matches one or more whitespace
+// characters in source.
+type Syntax struct {
+	Name      string
+	Exts      []string        // File extensions, including the dot
+	Spellings map[Type]string // Spelling of each instruction type
+	Separator string          // Spelling of code/input separator, if any
+}
+
+// Built-in syntaxes.
+var (
+	Brainfuck = &Syntax{
+		Name: "brainfuck",
+		Exts: []string{".bf", ".b"},
+		Spellings: map[Type]string{
+			IncPtr:     ">",
+			DecPtr:     "<",
+			IncData:    "+",
+			DecData:    "-",
+			Print:      ".",
+			Read:       ",",
+			Bracket:    "[",
+			EndBracket: "]",
+			Debug:      "#",
+		},
+		Separator: "!",
+	}
+	Ook = &Syntax{
+		Name: "ook",
+		Exts: []string{".ook"},
+		Spellings: map[Type]string{
+			IncPtr:     "Ook. Ook?",
+			DecPtr:     "Ook? Ook.",
+			IncData:    "Ook. Ook.",
+			DecData:    "Ook! Ook!",
+			Print:      "Ook! Ook.",
+			Read:       "Ook. Ook!",
+			Bracket:    "Ook! Ook?",
+			EndBracket: "Ook? Ook!",
+		},
+	}
+	Blub = &Syntax{
+		Name: "blub",
+		Exts: []string{".blub"},
+		Spellings: map[Type]string{
+			IncPtr:     "Blub. Blub?",
+			DecPtr:     "Blub? Blub.",
+			IncData:    "Blub. Blub.",
+			DecData:    "Blub! Blub!",
+			Print:      "Blub! Blub.",
+			Read:       "Blub. Blub!",
+			Bracket:    "Blub! Blub?",
+			EndBracket: "Blub? Blub!",
+		},
+	}
+	Pikalang = &Syntax{
+		Name: "pikalang",
+		Exts: []string{".pokeball"},
+		Spellings: map[Type]string{
+			IncPtr:     "pipi",
+			DecPtr:     "pichu",
+			IncData:    "pi",
+			DecData:    "ka",
+			Print:      "pikachu",
+			Read:       "pikapi",
+			Bracket:    "pika",
+			EndBracket: "chu",
+		},
+	}
+)
+
+var syntaxes = []*Syntax{Brainfuck, Ook, Blub, Pikalang}
+
+// LookupSyntax looks up a built-in syntax by name.
+func LookupSyntax(name string) (*Syntax, bool) {
+	for _, s := range syntaxes {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return nil, false
+}
+
+// LookupExt looks up the built-in syntax for the extension of a
+// filename.
+func LookupExt(filename string) (*Syntax, bool) {
+	ext := filepath.Ext(filename)
+	for _, s := range syntaxes {
+		for _, e := range s.Exts {
+			if ext == e {
+				return s, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// SyntaxNames returns the names of all built-in syntaxes.
+func SyntaxNames() []string {
+	names := make([]string, len(syntaxes))
+	for i, s := range syntaxes {
+		names[i] = s.Name
+	}
+	return names
+}
+
+type spelling struct {
+	Type  Type
+	Words [][]byte
+}
+
+// spellings returns the spellings split at spaces, longest first, so
+// that the longest spelling is matched when one prefixes another.
+func (s *Syntax) spellings() []spelling {
+	spellings := make([]spelling, 0, len(s.Spellings))
+	for typ, spell := range s.Spellings {
+		spellings = append(spellings, spelling{typ, bytes.Split([]byte(spell), []byte{' '})})
+	}
+	sort.Slice(spellings, func(i, j int) bool {
+		li, lj := len(s.Spellings[spellings[i].Type]), len(s.Spellings[spellings[j].Type])
+		if li != lj {
+			return li > lj
+		}
+		return spellings[i].Type < spellings[j].Type
+	})
+	return spellings
+}
+
+// match returns the length of source text matched by the spelling at
+// the start of src, or -1 when it does not match.
+func (spell spelling) match(src []byte) int {
+	n := 0
+	for i, word := range spell.Words {
+		if i != 0 {
+			start := n
+			for n < len(src) && isSpace(src[n]) {
+				n++
+			}
+			if n == start {
+				return -1
+			}
+		}
+		if !bytes.HasPrefix(src[n:], word) {
+			return -1
+		}
+		n += len(word)
+	}
+	return n
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r':
+		return true
+	}
+	return false
+}
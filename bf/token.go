@@ -5,7 +5,6 @@ package bf // import "github.com/andrewarchi/nebula/bf"
 import (
 	"fmt"
 	"go/token"
-	"strings"
 )
 
 // Token is a lexical token in Brainfuck.
@@ -28,6 +27,7 @@ const (
 	Read            // ,
 	Bracket         // [
 	EndBracket      // ]
+	Debug           // # (extension)
 )
 
 func (typ Type) String() string {
@@ -48,6 +48,8 @@ func (typ Type) String() string {
 		return "bracket"
 	case EndBracket:
 		return "endbracket"
+	case Debug:
+		return "debug"
 	}
 	return fmt.Sprintf("token(%d)", int(typ))
 }
@@ -71,6 +73,8 @@ func (typ Type) StringBF() string {
 		return "["
 	case EndBracket:
 		return "]"
+	case Debug:
+		return "#"
 	}
 	return fmt.Sprintf("token(%d)", int(typ))
 }
@@ -79,26 +83,10 @@ func (typ Type) StringBF() string {
 type Program struct {
 	Tokens []*Token
 	File   *token.File
+	Config Config
+	Input  []byte // Input embedded after a separator, if any
 }
 
 func (p *Program) String() string {
-	var b strings.Builder
-	indent := "  "
-	indentLevel := 0
-	var prev Type
-	for i, tok := range p.Tokens {
-		if tok.Type == EndBracket && indentLevel > 0 {
-			indentLevel--
-		}
-		if (prev != tok.Type && i != 0) || tok.Type == Bracket || tok.Type == EndBracket {
-			b.WriteByte('\n')
-			b.WriteString(strings.Repeat(indent, indentLevel))
-		}
-		if tok.Type == Bracket {
-			indentLevel++
-		}
-		b.WriteString(tok.Type.StringBF())
-		prev = tok.Type
-	}
-	return b.String()
+	return p.Format(Brainfuck, Indented)
 }
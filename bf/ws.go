@@ -0,0 +1,283 @@
+package bf
+
+import (
+	"errors"
+	"fmt"
+	"go/token"
+	"math/big"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// wsBuilder translates Brainfuck operations to Whitespace. The data
+// pointer is kept on top of the stack and cells use the same heap
+// layout as the IR lowering. Heap cell 0 is scratch space for reads.
+type wsBuilder struct {
+	config  Config
+	input   []byte
+	tokens  []*ws.Token
+	labels  int64
+	loops   int
+	reads   int
+	modulus int64    // 2^CellBits when cells wrap
+	hang    *big.Int // Label of infinite loop for clear and multiply loops, if used
+}
+
+// TranspileWS translates a Brainfuck program to an equivalent
+// Whitespace program. Labels are named by the loop or read that they
+// implement. Bounds checking and debug dumps are not supported, as
+// they have no equivalent in standard Whitespace.
+func (p *Program) TranspileWS() (*ws.Program, []error) {
+	if err := p.Config.Validate(); err != nil {
+		return nil, []error{err}
+	}
+	if p.Config.CheckBounds {
+		return nil, []error{errors.New("bounds checking is not supported in Whitespace")}
+	}
+	for _, tok := range p.Tokens {
+		if tok.Type == Debug {
+			return nil, []error{fmt.Errorf("debug dump is not supported in Whitespace at %v", tok.Pos)}
+		}
+	}
+	ops, errs := parseOps(p.Tokens, p.Config.wraps())
+	b := &wsBuilder{config: p.Config, input: p.Input}
+	if p.Config.wraps() {
+		b.modulus = 1 << p.Config.CellBits
+	}
+	if p.Input != nil {
+		b.push(inputPosAddr, token.NoPos)
+		b.push(0, token.NoPos)
+		b.emit(ws.Store, token.NoPos)
+		for i, c := range p.Input {
+			b.push(inputAddr+int64(i), token.NoPos)
+			b.push(int64(c), token.NoPos)
+			b.emit(ws.Store, token.NoPos)
+		}
+	}
+	b.push(p.tapeBase(), token.NoPos)
+	b.translateOps(ops)
+	exitPos := token.NoPos
+	if len(p.Tokens) != 0 {
+		exitPos = p.Tokens[len(p.Tokens)-1].Pos
+	}
+	b.emit(ws.End, exitPos)
+	if b.hang != nil {
+		b.label(b.hang, "hang", exitPos)
+		b.jump(ws.Jmp, b.hang, "hang", exitPos)
+	}
+	return &ws.Program{Tokens: b.tokens, File: p.File}, errs
+}
+
+func (b *wsBuilder) translateOps(ops []op) {
+	for _, o := range ops {
+		switch o.Kind {
+		case moveOp:
+			b.push(o.N, o.Pos)
+			b.emit(ws.Add, o.Pos)
+		case addOp:
+			b.emit(ws.Dup, o.Pos)
+			b.emit(ws.Dup, o.Pos)
+			b.emit(ws.Retrieve, o.Pos)
+			b.push(b.wrapConst(o.N), o.Pos)
+			b.emit(ws.Add, o.Pos)
+			b.wrap(o.Pos)
+			b.emit(ws.Store, o.Pos)
+		case printOp:
+			b.emit(ws.Dup, o.Pos)
+			b.emit(ws.Retrieve, o.Pos)
+			b.emit(ws.Printc, o.Pos)
+		case readOp:
+			if b.input != nil {
+				b.translateInputRead(o.Pos)
+			} else {
+				b.translateRead(o.Pos)
+			}
+		case clearOp:
+			b.hangIfNegative(o.Pos)
+			b.emit(ws.Dup, o.Pos)
+			b.push(0, o.Pos)
+			b.emit(ws.Store, o.Pos)
+		case mulOp:
+			b.translateMul(o)
+		case loopOp:
+			b.loops++
+			name := fmt.Sprintf("loop%d", b.loops)
+			start, end := b.newLabel(), b.newLabel()
+			b.label(start, name, o.Pos)
+			b.emit(ws.Dup, o.Pos)
+			b.emit(ws.Retrieve, o.Pos)
+			b.jump(ws.Jz, end, name+"_end", o.Pos)
+			b.translateOps(o.Body)
+			b.jump(ws.Jmp, start, name, o.End)
+			b.label(end, name+"_end", o.End)
+		}
+	}
+}
+
+// translateRead translates a read from stdin. Unless -1 is stored with
+// unbounded cells, the character is read into scratch space and checked
+// for EOF before storing.
+func (b *wsBuilder) translateRead(pos token.Pos) {
+	if b.config.EOF == EOFMinusOne && !b.config.wraps() {
+		b.emit(ws.Dup, pos)
+		b.emit(ws.Readc, pos)
+		return
+	}
+	b.reads++
+	name := fmt.Sprintf("read%d", b.reads)
+	eof, end := b.newLabel(), b.newLabel()
+	b.push(dataPtrAddr, pos)
+	b.emit(ws.Readc, pos)
+	b.emit(ws.Dup, pos)
+	b.push(dataPtrAddr, pos)
+	b.emit(ws.Retrieve, pos)
+	b.emit(ws.Dup, pos)
+	b.jump(ws.Jn, eof, name+"_eof", pos)
+	b.emit(ws.Store, pos)
+	b.jump(ws.Jmp, end, name+"_end", pos)
+	b.label(eof, name+"_eof", pos)
+	b.emit(ws.Drop, pos)
+	switch b.config.EOF {
+	case EOFMinusOne:
+		b.push(b.wrapConst(-1), pos)
+		b.emit(ws.Store, pos)
+	case EOFZero:
+		b.push(0, pos)
+		b.emit(ws.Store, pos)
+	case EOFUnchanged:
+		b.emit(ws.Drop, pos)
+	}
+	b.label(end, name+"_end", pos)
+}
+
+// translateInputRead translates a read from the embedded input.
+func (b *wsBuilder) translateInputRead(pos token.Pos) {
+	b.reads++
+	name := fmt.Sprintf("read%d", b.reads)
+	avail, end := b.newLabel(), b.newLabel()
+	b.push(inputPosAddr, pos)
+	b.emit(ws.Retrieve, pos)
+	b.emit(ws.Dup, pos)
+	b.push(int64(len(b.input)), pos)
+	b.emit(ws.Sub, pos)
+	b.jump(ws.Jn, avail, name+"_avail", pos)
+	b.emit(ws.Drop, pos)
+	switch b.config.EOF {
+	case EOFMinusOne:
+		b.emit(ws.Dup, pos)
+		b.push(b.wrapConst(-1), pos)
+		b.emit(ws.Store, pos)
+	case EOFZero:
+		b.emit(ws.Dup, pos)
+		b.push(0, pos)
+		b.emit(ws.Store, pos)
+	}
+	b.jump(ws.Jmp, end, name+"_end", pos)
+	b.label(avail, name+"_avail", pos)
+	b.emit(ws.Dup, pos)
+	b.push(inputAddr, pos)
+	b.emit(ws.Add, pos)
+	b.emit(ws.Retrieve, pos)
+	b.copy(2, pos)
+	b.emit(ws.Swap, pos)
+	b.emit(ws.Store, pos)
+	b.push(1, pos)
+	b.emit(ws.Add, pos)
+	b.push(inputPosAddr, pos)
+	b.emit(ws.Swap, pos)
+	b.emit(ws.Store, pos)
+	b.label(end, name+"_end", pos)
+}
+
+// translateMul translates a multiply loop. The loop count is retrieved
+// for each term, so that only the data pointer stays on the stack.
+func (b *wsBuilder) translateMul(mul op) {
+	pos := mul.Pos
+	b.hangIfNegative(pos)
+	for _, term := range mul.Terms {
+		b.emit(ws.Dup, pos)
+		b.push(term.Offset, pos)
+		b.emit(ws.Add, pos)
+		b.emit(ws.Dup, pos)
+		b.emit(ws.Retrieve, pos)
+		b.copy(2, pos)
+		b.emit(ws.Retrieve, pos)
+		if mul.N > 0 { // wrapping increment loop runs until overflow
+			b.push(b.modulus, pos)
+			b.emit(ws.Swap, pos)
+			b.emit(ws.Sub, pos)
+		}
+		if factor := b.wrapConst(term.Factor); factor != 1 {
+			b.push(factor, pos)
+			b.emit(ws.Mul, pos)
+		}
+		b.emit(ws.Add, pos)
+		b.wrap(pos)
+		b.emit(ws.Store, pos)
+	}
+	b.emit(ws.Dup, pos)
+	b.push(0, pos)
+	b.emit(ws.Store, pos)
+}
+
+// hangIfNegative jumps to an infinite loop when the current cell is
+// negative with unbounded cells, as a clear or multiply loop would
+// never terminate.
+func (b *wsBuilder) hangIfNegative(pos token.Pos) {
+	if b.modulus != 0 {
+		return
+	}
+	if b.hang == nil {
+		b.hang = b.newLabel()
+	}
+	b.emit(ws.Dup, pos)
+	b.emit(ws.Retrieve, pos)
+	b.jump(ws.Jn, b.hang, "hang", pos)
+}
+
+// wrapConst reduces a constant to the cell width, so that wrapped sums
+// are non-negative and mod behaves the same in all interpreters.
+func (b *wsBuilder) wrapConst(n int64) int64 {
+	if b.modulus == 0 {
+		return n
+	}
+	n %= b.modulus
+	if n < 0 {
+		n += b.modulus
+	}
+	return n
+}
+
+// wrap truncates the value on top of the stack to the cell width, if
+// cells wrap.
+func (b *wsBuilder) wrap(pos token.Pos) {
+	if b.modulus != 0 {
+		b.push(b.modulus, pos)
+		b.emit(ws.Mod, pos)
+	}
+}
+
+func (b *wsBuilder) emit(typ ws.Type, pos token.Pos) {
+	b.tokens = append(b.tokens, &ws.Token{Type: typ, Pos: pos})
+}
+
+func (b *wsBuilder) push(n int64, pos token.Pos) {
+	b.tokens = append(b.tokens, &ws.Token{Type: ws.Push, Arg: big.NewInt(n), Pos: pos})
+}
+
+func (b *wsBuilder) copy(n int64, pos token.Pos) {
+	b.tokens = append(b.tokens, &ws.Token{Type: ws.Copy, Arg: big.NewInt(n), Pos: pos})
+}
+
+func (b *wsBuilder) newLabel() *big.Int {
+	b.labels++
+	return big.NewInt(b.labels)
+}
+
+func (b *wsBuilder) label(l *big.Int, name string, pos token.Pos) {
+	b.tokens = append(b.tokens, &ws.Token{Type: ws.Label, Arg: l, ArgString: name, Pos: pos})
+}
+
+func (b *wsBuilder) jump(typ ws.Type, l *big.Int, name string, pos token.Pos) {
+	b.tokens = append(b.tokens, &ws.Token{Type: typ, Arg: l, ArgString: name, Pos: pos})
+}
@@ -0,0 +1,155 @@
+package bf
+
+import (
+	"go/token"
+	"testing"
+)
+
+func TestTranspileWS(t *testing.T) {
+	src := ",[.[-]>+<,]>[->++<]"
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src), Brainfuck)
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+	p := &Program{Tokens: tokens, File: file, Config: Config{CellBits: 8, EOF: EOFZero}}
+	wsProgram, errs := p.TranspileWS()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	want := `    push 1
+    push 0
+    readc
+    dup
+    push 0
+    retrieve
+    dup
+    jn read1_eof
+    store
+    jmp read1_end
+read1_eof:
+    drop
+    push 0
+    store
+read1_end:
+loop1:
+    dup
+    retrieve
+    jz loop1_end
+    dup
+    retrieve
+    printc
+    dup
+    push 0
+    store
+    push 1
+    add
+    dup
+    dup
+    retrieve
+    push 1
+    add
+    push 256
+    mod
+    store
+    push -1
+    add
+    push 0
+    readc
+    dup
+    push 0
+    retrieve
+    dup
+    jn read2_eof
+    store
+    jmp read2_end
+read2_eof:
+    drop
+    push 0
+    store
+read2_end:
+    jmp loop1
+loop1_end:
+    push 1
+    add
+    dup
+    push 1
+    add
+    dup
+    retrieve
+    copy 2
+    retrieve
+    push 2
+    mul
+    add
+    push 256
+    mod
+    store
+    dup
+    push 0
+    store
+    end
+`
+	if got := wsProgram.Dump("    "); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	if _, errs := wsProgram.LowerIR(); len(errs) != 0 {
+		t.Errorf("lowering transpiled program: %v", errs)
+	}
+}
+
+func TestTranspileWSCheckBounds(t *testing.T) {
+	p := &Program{Config: Config{CheckBounds: true}}
+	if _, errs := p.TranspileWS(); len(errs) != 1 {
+		t.Errorf("got errors %v, want bounds checking unsupported", errs)
+	}
+}
+
+func TestTranspileWSDebug(t *testing.T) {
+	p := &Program{Tokens: []*Token{{Type: Debug}}}
+	if _, errs := p.TranspileWS(); len(errs) != 1 {
+		t.Errorf("got errors %v, want debug dump unsupported", errs)
+	}
+}
+
+func TestTranspileWSNegativeClear(t *testing.T) {
+	src := "-[-]+."
+	file := token.NewFileSet().AddFile("test", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src), Brainfuck)
+	if err != nil {
+		t.Fatalf("lex: %v", err)
+	}
+	wsProgram, errs := (&Program{Tokens: tokens, File: file}).TranspileWS()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	want := `    push 1
+    dup
+    dup
+    retrieve
+    push -1
+    add
+    store
+    dup
+    retrieve
+    jn hang
+    dup
+    push 0
+    store
+    dup
+    dup
+    retrieve
+    push 1
+    add
+    store
+    dup
+    retrieve
+    printc
+    end
+hang:
+    jmp hang
+`
+	if got := wsProgram.Dump("    "); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
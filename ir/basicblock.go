@@ -2,6 +2,7 @@ package ir
 
 import (
 	"fmt"
+	"go/token"
 	"math/big"
 )
 
@@ -18,6 +19,39 @@ type BasicBlock struct {
 	Returns    []*BasicBlock // Returning blocks; blocks returning to this block
 	Prev       *BasicBlock   // Predecessor block in source
 	Next       *BasicBlock   // Successor block in source
+	Meta       *Annotations  // Compiler annotations from source, if any
+}
+
+// Annotations are compiler metadata for a block given in source. Label
+// annotations describe the routine starting at the block and assertions
+// are checked at points within the block.
+type Annotations struct {
+	Stack    *StackSig    // Stack signature of routine
+	Pure     bool         // Routine has no I/O or heap stores
+	NoReturn bool         // Routine never returns to its caller
+	Pos      token.Pos    // Position of first label annotation
+	Asserts  []*Assertion // Assertions within block
+}
+
+// StackSig is the stack signature of a routine: the number of values
+// it consumes and the number that it leaves in their place.
+type StackSig struct {
+	Pops   uint
+	Pushes uint
+	Pos    token.Pos
+}
+
+func (sig *StackSig) String() string {
+	return fmt.Sprintf("%d -> %d", sig.Pops, sig.Pushes)
+}
+
+// Annotate returns the annotations of the block, creating them if not
+// yet annotated.
+func (block *BasicBlock) Annotate() *Annotations {
+	if block.Meta == nil {
+		block.Meta = &Annotations{}
+	}
+	return block.Meta
 }
 
 // Label is a label with an optional name.
@@ -127,6 +127,22 @@ func (b *Builder) CreateOffsetStackStmt(offset int, pos token.Pos) *OffsetStackS
 	return off
 }
 
+// CreateShuffleStackStmt constructs a ShuffleStackStmt and appends it
+// to the current block.
+func (b *Builder) CreateShuffleStackStmt(pos token.Pos) *ShuffleStackStmt {
+	shuffle := NewShuffleStackStmt(pos)
+	b.curr.AppendInst(shuffle)
+	return shuffle
+}
+
+// CreateDebugStmt constructs a DebugStmt and appends it to the current
+// block.
+func (b *Builder) CreateDebugStmt(op DebugOp, pos token.Pos) *DebugStmt {
+	debug := NewDebugStmt(op, pos)
+	b.curr.AppendInst(debug)
+	return debug
+}
+
 // CreateLoadHeapExpr constructs a LoadHeapExpr and appends it to the
 // current block.
 func (b *Builder) CreateLoadHeapExpr(addr Value, pos token.Pos) *LoadHeapExpr {
@@ -143,6 +159,14 @@ func (b *Builder) CreateStoreHeapStmt(addr, val Value, pos token.Pos) *StoreHeap
 	return store
 }
 
+// CreateAccessHeapStmt constructs a AccessHeapStmt and appends it to
+// the current block.
+func (b *Builder) CreateAccessHeapStmt(addr Value, min, max uint, pos token.Pos) *AccessHeapStmt {
+	access := NewAccessHeapStmt(addr, min, max, pos)
+	b.curr.AppendInst(access)
+	return access
+}
+
 // CreatePrintStmt constructs a PrintStmt and appends it to the current
 // block.
 func (b *Builder) CreatePrintStmt(op PrintOp, val Value, pos token.Pos) *PrintStmt {
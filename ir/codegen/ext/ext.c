@@ -1,9 +1,13 @@
 #include <stdint.h>
 #include <stdio.h>
 #include <stdlib.h>
+#include <time.h>
+#include <unistd.h>
 
+extern int64_t stack[];
 extern uint64_t stack_len;
 extern uint64_t call_stack_len;
+extern int64_t heap[];
 
 void print_byte(int64_t b) {
   fputc(b, stdout);
@@ -44,3 +48,89 @@ void check_call_stack(char *block, char *pos) {
     exit(1);
   }
 }
+
+// Exits with an error when a heap address is outside of [min, max).
+void check_heap(int64_t addr, int64_t min, int64_t max, char *block, char *pos) {
+  if (addr < min || addr >= max) {
+    fprintf(stderr, "Heap address %lld out of bounds in %s at %s\n",
+            (long long) addr, block, pos);
+    fflush(stderr);
+    exit(1);
+  }
+}
+
+// Returns 64 random bits from rand, which yields at least 15 bits per
+// call.
+static uint64_t rand64() {
+  uint64_t r = 0;
+  for (int i = 0; i < 5; i++) {
+    r = r << 15 | (rand() & 0x7fff);
+  }
+  return r;
+}
+
+// Returns a uniformly random integer in [0, n) by rejecting the values
+// below 2^64 mod n that would bias the remainder.
+static uint64_t rand_below(uint64_t n) {
+  uint64_t min = -n % n;
+  uint64_t r;
+  do {
+    r = rand64();
+  } while (r < min);
+  return r % n;
+}
+
+// Randomly permutes the stack with a Fisher-Yates shuffle. The random
+// generator is seeded from NEBULA_SEED, when set, so that shuffles can
+// be reproduced.
+void shuffle_stack() {
+  static int seeded = 0;
+  if (!seeded) {
+    char *seed = getenv("NEBULA_SEED");
+    if (seed != NULL) {
+      srand((unsigned) strtoul(seed, NULL, 10));
+    } else {
+      srand((unsigned) time(NULL) ^ (unsigned) getpid() << 16);
+    }
+    seeded = 1;
+  }
+  for (uint64_t i = stack_len; i > 1; i--) {
+    uint64_t j = rand_below(i);
+    int64_t tmp = stack[i - 1];
+    stack[i - 1] = stack[j];
+    stack[j] = tmp;
+  }
+}
+
+// Prints the stack from top to bottom in Burghard's format.
+void dump_stack() {
+  printf("Stack: [");
+  for (uint64_t i = stack_len; i > 0; i--) {
+    printf(i == stack_len ? "%lld" : ",%lld", (long long) stack[i - 1]);
+  }
+  printf("]\n");
+  fflush(stdout);
+}
+
+// Prints the non-zero heap cells below bound in Burghard's format.
+void dump_heap(uint64_t bound) {
+  int first = 1;
+  printf("Heap: [");
+  for (uint64_t i = 0; i < bound; i++) {
+    if (heap[i] != 0) {
+      printf(first ? "(%llu,%lld)" : ",(%llu,%lld)",
+             (unsigned long long) i, (long long) heap[i]);
+      first = 0;
+    }
+  }
+  printf("]\n");
+  fflush(stdout);
+}
+
+// Prints the block and source position of a trace instruction, followed
+// by the stack and the non-zero heap cells below bound.
+void trace(char *block, char *pos, uint64_t bound) {
+  printf("Trace in %s at %s\n", block, pos);
+  dump_stack();
+  dump_heap(bound);
+}
@@ -36,6 +36,11 @@ type moduleBuilder struct {
 	flush          llvm.Value
 	checkStack     llvm.Value
 	checkCallStack llvm.Value
+	checkHeap      llvm.Value
+	shuffleStack   llvm.Value
+	trace          llvm.Value
+	dumpStack      llvm.Value
+	dumpHeap       llvm.Value
 }
 
 // Config contains allocation size configuration for codegen.
@@ -89,6 +94,11 @@ func (m *moduleBuilder) declareFuncs() {
 	cStrTyp := llvm.PointerType(llvm.Int8Type(), 0)
 	checkStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type(), cStrTyp, cStrTyp}, false)
 	checkCallStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{cStrTyp, cStrTyp}, false)
+	checkHeapTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type(), llvm.Int64Type(), llvm.Int64Type(), cStrTyp, cStrTyp}, false)
+	shuffleStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{}, false)
+	traceTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{cStrTyp, cStrTyp, llvm.Int64Type()}, false)
+	dumpStackTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{}, false)
+	dumpHeapTyp := llvm.FunctionType(llvm.VoidType(), []llvm.Type{llvm.Int64Type()}, false)
 
 	m.printByte = llvm.AddFunction(m.module, "print_byte", printcTyp)
 	m.printInt = llvm.AddFunction(m.module, "print_int", printiTyp)
@@ -97,6 +107,11 @@ func (m *moduleBuilder) declareFuncs() {
 	m.flush = llvm.AddFunction(m.module, "flush", flushTyp)
 	m.checkStack = llvm.AddFunction(m.module, "check_stack", checkStackTyp)
 	m.checkCallStack = llvm.AddFunction(m.module, "check_call_stack", checkCallStackTyp)
+	m.checkHeap = llvm.AddFunction(m.module, "check_heap", checkHeapTyp)
+	m.shuffleStack = llvm.AddFunction(m.module, "shuffle_stack", shuffleStackTyp)
+	m.trace = llvm.AddFunction(m.module, "trace", traceTyp)
+	m.dumpStack = llvm.AddFunction(m.module, "dump_stack", dumpStackTyp)
+	m.dumpHeap = llvm.AddFunction(m.module, "dump_heap", dumpHeapTyp)
 
 	m.printByte.SetLinkage(llvm.ExternalLinkage)
 	m.printInt.SetLinkage(llvm.ExternalLinkage)
@@ -105,6 +120,11 @@ func (m *moduleBuilder) declareFuncs() {
 	m.flush.SetLinkage(llvm.ExternalLinkage)
 	m.checkStack.SetLinkage(llvm.ExternalLinkage)
 	m.checkCallStack.SetLinkage(llvm.ExternalLinkage)
+	m.checkHeap.SetLinkage(llvm.ExternalLinkage)
+	m.shuffleStack.SetLinkage(llvm.ExternalLinkage)
+	m.trace.SetLinkage(llvm.ExternalLinkage)
+	m.dumpStack.SetLinkage(llvm.ExternalLinkage)
+	m.dumpHeap.SetLinkage(llvm.ExternalLinkage)
 }
 
 func (m *moduleBuilder) declareGlobals() {
@@ -202,6 +222,8 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		n := llvm.ConstInt(llvm.Int64Type(), uint64(inst.Offset), false)
 		stackLen = m.b.CreateAdd(stackLen, n, "offsetstack")
 		m.b.CreateStore(stackLen, m.stackLen)
+	case *ir.ShuffleStackStmt:
+		m.b.CreateCall(m.shuffleStack, []llvm.Value{}, "")
 	case *ir.LoadHeapExpr:
 		addr := m.heapAddr(inst.Operand(0).Def())
 		m.defs[inst] = m.b.CreateLoad(addr, "loadheap")
@@ -209,6 +231,15 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		addr := m.heapAddr(inst.Operand(0).Def())
 		val := m.lookupValue(inst.Operand(1).Def())
 		m.b.CreateStore(val, addr)
+	case *ir.AccessHeapStmt:
+		addr := m.lookupValue(inst.Operand(0).Def())
+		max := inst.Max
+		if max == 0 || max > m.config.MaxHeapBound {
+			max = m.config.MaxHeapBound
+		}
+		lo := llvm.ConstInt(llvm.Int64Type(), uint64(inst.Min), false)
+		hi := llvm.ConstInt(llvm.Int64Type(), uint64(max), false)
+		m.b.CreateCall(m.checkHeap, []llvm.Value{addr, lo, hi, m.blockName(block), m.instPos(inst)}, "")
 	case *ir.PrintStmt:
 		var f llvm.Value
 		switch inst.Op {
@@ -234,6 +265,19 @@ func (m *moduleBuilder) emitInst(inst ir.Inst, block *ir.BasicBlock, stackLen ll
 		m.defs[inst] = m.b.CreateCall(f, []llvm.Value{}, "read")
 	case *ir.FlushStmt:
 		m.b.CreateCall(m.flush, []llvm.Value{}, "")
+	case *ir.DebugStmt:
+		switch inst.Op {
+		case ir.Trace:
+			n := llvm.ConstInt(llvm.Int64Type(), uint64(m.config.MaxHeapBound), false)
+			m.b.CreateCall(m.trace, []llvm.Value{m.blockName(block), m.instPos(inst), n}, "")
+		case ir.DumpStack:
+			m.b.CreateCall(m.dumpStack, []llvm.Value{}, "")
+		case ir.DumpHeap:
+			n := llvm.ConstInt(llvm.Int64Type(), uint64(m.config.MaxHeapBound), false)
+			m.b.CreateCall(m.dumpHeap, []llvm.Value{n}, "")
+		default:
+			panic("codegen: unrecognized debug op")
+		}
 	default:
 		panic("codegen: unrecognized instruction type")
 	}
@@ -293,12 +337,12 @@ func (m *moduleBuilder) lookupValue(val ir.Value) llvm.Value {
 		if i64, ok := bigint.ToInt64(v.Int()); ok {
 			return llvm.ConstInt(llvm.Int64Type(), uint64(i64), false)
 		}
-		panic(fmt.Sprintf("codegen: value overflows 64 bits: %v at %v", v, m.program.File.Position(v.Pos())))
+		panic(fmt.Sprintf("codegen: value overflows 64 bits: %v at %v", v, m.program.Position(v.Pos())))
 	default:
 		if ident, ok := m.defs[v]; ok {
 			return ident
 		}
-		panic(fmt.Sprintf("codegen: def not found: %v at %v", v, m.program.File.Position(v.Pos())))
+		panic(fmt.Sprintf("codegen: def not found: %v at %v", v, m.program.Position(v.Pos())))
 	}
 }
 
@@ -331,7 +375,7 @@ func (m *moduleBuilder) blockName(block *ir.BasicBlock) llvm.Value {
 func (m *moduleBuilder) instPos(inst ir.Inst) llvm.Value {
 	str := "<unknown>"
 	if pos := inst.Pos(); pos != token.NoPos {
-		str = m.program.File.Position(inst.Pos()).String()
+		str = m.program.Position(inst.Pos()).String()
 	}
 	return m.b.CreateInBoundsGEP(m.constString(str), []llvm.Value{zero, zero}, "op")
 }
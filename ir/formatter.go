@@ -53,6 +53,22 @@ func (f *Formatter) FormatBlock(block *BasicBlock) string {
 		writeBlockSlice(&b, block.Returns)
 	}
 	b.WriteByte('\n')
+	if meta := block.Meta; meta != nil {
+		if meta.Stack != nil {
+			fmt.Fprintf(&b, "    ; stack: %v\n", meta.Stack)
+		}
+		if meta.Pure {
+			b.WriteString("    ; pure\n")
+		}
+		if meta.NoReturn {
+			b.WriteString("    ; noreturn\n")
+		}
+		for _, assert := range meta.Asserts {
+			b.WriteString("    ; ")
+			b.WriteString(f.FormatInst(assert))
+			b.WriteByte('\n')
+		}
+	}
 
 	for _, inst := range block.Nodes {
 		b.WriteString("    ")
@@ -171,5 +187,7 @@ func writeStackPos(b *strings.Builder, inst Inst) {
 		fmt.Fprintf(b, " %d", s.StackSize)
 	case *OffsetStackStmt:
 		fmt.Fprintf(b, " %d", s.Offset)
+	case *AccessHeapStmt:
+		fmt.Fprintf(b, " %d %d", s.Min, s.Max)
 	}
 }
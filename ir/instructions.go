@@ -384,6 +384,20 @@ func NewOffsetStackStmt(offset int, pos token.Pos) *OffsetStackStmt {
 // OpString pretty prints the op kind.
 func (*OffsetStackStmt) OpString() string { return "offsetstack" }
 
+// ShuffleStackStmt is a statement that randomly permutes the entire
+// stack. Stack values must be stored beforehand.
+type ShuffleStackStmt struct {
+	PosBase
+}
+
+// NewShuffleStackStmt constructs a ShuffleStackStmt.
+func NewShuffleStackStmt(pos token.Pos) *ShuffleStackStmt {
+	return &ShuffleStackStmt{PosBase: PosBase{pos: pos}}
+}
+
+// OpString pretty prints the op kind.
+func (*ShuffleStackStmt) OpString() string { return "shufflestack" }
+
 // LoadHeapExpr is an expression that loads a value at an address
 // from the heap.
 type LoadHeapExpr struct {
@@ -419,6 +433,64 @@ func NewStoreHeapStmt(addr, val Value, pos token.Pos) *StoreHeapStmt {
 // OpString pretty prints the op kind.
 func (*StoreHeapStmt) OpString() string { return "storeheap" }
 
+// AccessHeapStmt is a statement that asserts that an address is
+// within the heap bounds [Min, Max). A Max of 0 denotes the heap
+// allocation bound.
+type AccessHeapStmt struct {
+	Min, Max uint
+	UserBase
+	PosBase
+}
+
+// NewAccessHeapStmt constructs a AccessHeapStmt.
+func NewAccessHeapStmt(addr Value, min, max uint, pos token.Pos) *AccessHeapStmt {
+	access := &AccessHeapStmt{Min: min, Max: max, PosBase: PosBase{pos: pos}}
+	access.initOperands(access, addr)
+	return access
+}
+
+// OpString pretty prints the op kind.
+func (*AccessHeapStmt) OpString() string { return "accessheap" }
+
+// DebugOp is the operator kind of a debug statement.
+type DebugOp uint8
+
+// Debug operations.
+const (
+	Trace DebugOp = iota + 1
+	DumpStack
+	DumpHeap
+)
+
+func (op DebugOp) String() string {
+	switch op {
+	case Trace:
+		return "trace"
+	case DumpStack:
+		return "dumpstack"
+	case DumpHeap:
+		return "dumpheap"
+	}
+	return "debugerr"
+}
+
+// DebugStmt is a statement that prints debugging information to
+// stdout. Trace and DumpStack require stack values to be stored
+// beforehand and Trace and DumpHeap must not be reordered with heap
+// stores.
+type DebugStmt struct {
+	Op DebugOp
+	PosBase
+}
+
+// NewDebugStmt constructs a DebugStmt.
+func NewDebugStmt(op DebugOp, pos token.Pos) *DebugStmt {
+	return &DebugStmt{Op: op, PosBase: PosBase{pos: pos}}
+}
+
+// OpString pretty prints the op kind.
+func (debug *DebugStmt) OpString() string { return debug.Op.String() }
+
 // PrintOp is operator kind of a print statement.
 type PrintOp uint8
 
@@ -502,6 +574,76 @@ func NewFlushStmt(pos token.Pos) *FlushStmt {
 // OpString pretty prints the op kind.
 func (*FlushStmt) OpString() string { return "flush" }
 
+// CmpOp is the operator kind of an assertion.
+type CmpOp uint8
+
+// Comparison operations.
+const (
+	Eq CmpOp = iota + 1
+	Ne
+	Lt
+	Le
+	Gt
+	Ge
+)
+
+func (op CmpOp) String() string {
+	switch op {
+	case Eq:
+		return "eq"
+	case Ne:
+		return "ne"
+	case Lt:
+		return "lt"
+	case Le:
+		return "le"
+	case Gt:
+		return "gt"
+	case Ge:
+		return "ge"
+	}
+	return "cmperr"
+}
+
+// Eval evaluates the comparison of two integers.
+func (op CmpOp) Eval(x, y *big.Int) bool {
+	c := x.Cmp(y)
+	switch op {
+	case Eq:
+		return c == 0
+	case Ne:
+		return c != 0
+	case Lt:
+		return c < 0
+	case Le:
+		return c <= 0
+	case Gt:
+		return c > 0
+	case Ge:
+		return c >= 0
+	}
+	return false
+}
+
+// Assertion is a condition from source that is expected to hold at a
+// point in a block. Assertions are block metadata, not instructions, so
+// are not executed.
+type Assertion struct {
+	Op CmpOp
+	UserBase
+	PosBase
+}
+
+// NewAssertion constructs an Assertion.
+func NewAssertion(op CmpOp, lhs, rhs Value, pos token.Pos) *Assertion {
+	assert := &Assertion{Op: op, PosBase: PosBase{pos: pos}}
+	assert.initOperands(assert, lhs, rhs)
+	return assert
+}
+
+// OpString pretty prints the op kind.
+func (assert *Assertion) OpString() string { return "assert " + assert.Op.String() }
+
 // PhiExpr is an SSA Φ function with pairs of values and predecessor
 // blocks.
 type PhiExpr struct {
@@ -0,0 +1,166 @@
+package optimize
+
+import (
+	"fmt"
+	"go/token"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+// CheckAnnotations checks the annotations from source against the
+// code of the program and returns a diagnostic for each mismatch. Each
+// annotated label is checked as the entry of a routine, which extends
+// until ret, including called routines.
+func CheckAnnotations(p *ir.Program) []error {
+	c := &annotationChecker{program: p}
+	for _, block := range p.Blocks {
+		meta := block.Meta
+		if meta == nil {
+			continue
+		}
+		if meta.Stack != nil {
+			c.checkStack(block, meta.Stack)
+		}
+		if meta.Pure {
+			c.checkPure(block)
+		}
+		if meta.NoReturn {
+			c.checkNoReturn(block)
+		}
+		for _, assert := range meta.Asserts {
+			c.checkAssert(assert)
+		}
+	}
+	return c.errs
+}
+
+type annotationChecker struct {
+	program *ir.Program
+	errs    []error
+}
+
+func (c *annotationChecker) errorf(pos token.Pos, format string, args ...interface{}) {
+	c.errs = append(c.errs, fmt.Errorf("%v: %s", c.program.Position(pos), fmt.Sprintf(format, args...)))
+}
+
+// checkStack checks that a routine accesses no more values than its
+// signature consumes and that every ret leaves the stack offset by the
+// signature. Paths through calls to routines without a signature are
+// not checked.
+func (c *annotationChecker) checkStack(entry *ir.BasicBlock, sig *ir.StackSig) {
+	want := int(sig.Pushes) - int(sig.Pops)
+	heights := make(map[*ir.BasicBlock]int)
+	var visit func(block *ir.BasicBlock, h int)
+	visit = func(block *ir.BasicBlock, h int) {
+		if _, ok := heights[block]; ok {
+			return
+		}
+		heights[block] = h
+		for _, node := range block.Nodes {
+			switch inst := node.(type) {
+			case *ir.AccessStackStmt:
+				if int(inst.StackSize)-h > int(sig.Pops) {
+					c.errorf(inst.Pos(), "%s accesses %d values, but stack signature %v of %s consumes %d",
+						block.Name(), int(inst.StackSize)-h, sig, entry.Name(), sig.Pops)
+				}
+			case *ir.OffsetStackStmt:
+				h += inst.Offset
+			}
+		}
+		switch term := block.Terminator.(type) {
+		case *ir.CallTerm:
+			callee := term.Succ(0)
+			calleeSig := sig
+			if callee != entry {
+				if callee.Meta == nil || callee.Meta.Stack == nil {
+					return
+				}
+				if callee.Meta.NoReturn {
+					return
+				}
+				calleeSig = callee.Meta.Stack
+			}
+			if int(calleeSig.Pops)-h > int(sig.Pops) {
+				c.errorf(term.Pos(), "call to %s consumes %d values, but stack signature %v of %s consumes %d",
+					callee.Name(), int(calleeSig.Pops)-h, sig, entry.Name(), sig.Pops)
+			}
+			visit(term.Succ(1), h+int(calleeSig.Pushes)-int(calleeSig.Pops))
+		case *ir.RetTerm:
+			if h != want {
+				c.errorf(term.Pos(), "%s returns with stack offset %d, but stack signature %v of %s has offset %d",
+					block.Name(), h, sig, entry.Name(), want)
+			}
+		case *ir.ExitTerm:
+		default:
+			for _, succ := range block.Succs() {
+				visit(succ, h)
+			}
+		}
+	}
+	visit(entry, 0)
+}
+
+// checkPure checks that a routine and the routines it calls perform no
+// I/O and no heap stores.
+func (c *annotationChecker) checkPure(entry *ir.BasicBlock) {
+	c.visitRoutine(entry, true, func(block *ir.BasicBlock) {
+		for _, node := range block.Nodes {
+			switch node.(type) {
+			case *ir.PrintStmt, *ir.ReadExpr:
+				c.errorf(node.Pos(), "pure routine %s performs I/O in %s", entry.Name(), block.Name())
+			case *ir.StoreHeapStmt:
+				c.errorf(node.Pos(), "pure routine %s stores to heap in %s", entry.Name(), block.Name())
+			}
+		}
+	})
+}
+
+// checkNoReturn checks that a routine never reaches ret.
+func (c *annotationChecker) checkNoReturn(entry *ir.BasicBlock) {
+	c.visitRoutine(entry, false, func(block *ir.BasicBlock) {
+		if ret, ok := block.Terminator.(*ir.RetTerm); ok {
+			c.errorf(ret.Pos(), "noreturn routine %s returns in %s", entry.Name(), block.Name())
+		}
+	})
+}
+
+// checkAssert checks an assertion with constant operands.
+func (c *annotationChecker) checkAssert(assert *ir.Assertion) {
+	lhs, ok1 := assert.Operand(0).Def().(*ir.IntConst)
+	rhs, ok2 := assert.Operand(1).Def().(*ir.IntConst)
+	if ok1 && ok2 && !assert.Op.Eval(lhs.Int(), rhs.Int()) {
+		c.errorf(assert.Pos(), "assertion failed: %v %v %v", lhs.Int(), assert.Op, rhs.Int())
+	}
+}
+
+// visitRoutine calls fn for each block reachable from entry without
+// passing through ret. Calls continue at the return point, unless the
+// callee is annotated noreturn, and callees are visited when
+// enterCalls is set.
+func (c *annotationChecker) visitRoutine(entry *ir.BasicBlock, enterCalls bool, fn func(block *ir.BasicBlock)) {
+	visited := make(map[*ir.BasicBlock]bool)
+	var visit func(block *ir.BasicBlock)
+	visit = func(block *ir.BasicBlock) {
+		if visited[block] {
+			return
+		}
+		visited[block] = true
+		fn(block)
+		switch term := block.Terminator.(type) {
+		case *ir.CallTerm:
+			callee := term.Succ(0)
+			if enterCalls {
+				visit(callee)
+			}
+			if callee.Meta == nil || !callee.Meta.NoReturn {
+				visit(term.Succ(1))
+			}
+		case *ir.RetTerm, *ir.ExitTerm:
+		default:
+			for _, succ := range block.Succs() {
+				visit(succ)
+			}
+		}
+	}
+	visit(entry)
+}
@@ -0,0 +1,65 @@
+package optimize
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestCheckAnnotations(t *testing.T) {
+	// push 3       ; 1
+	// push 4       ; 2
+	// @assert s0 == 5
+	// add          ; 3 (asserted)
+	// call f       ; 4
+	// end          ; 5
+	// @stack 1 -> 1
+	// @pure
+	// @noreturn
+	// f:           ; 6
+	// printi       ; 7
+	// ret          ; 8
+
+	assert := &ws.Assertion{Op: ir.Eq, Args: [2]ws.AssertArg{{Slot: 0}, {Int: big.NewInt(5)}}, Pos: 3}
+	meta := &ir.Annotations{Stack: &ir.StackSig{Pops: 1, Pushes: 1, Pos: 6}, Pure: true, NoReturn: true, Pos: 6}
+	tokens := []*ws.Token{
+		{Type: ws.Push, Arg: big.NewInt(3), Pos: 1, End: 1},
+		{Type: ws.Push, Arg: big.NewInt(4), Pos: 2, End: 2},
+		{Type: ws.Add, Pos: 3, End: 3, Asserts: []*ws.Assertion{assert}},
+		{Type: ws.Call, Arg: big.NewInt(1), Pos: 4, End: 4},
+		{Type: ws.End, Pos: 5, End: 5},
+		{Type: ws.Label, Arg: big.NewInt(1), ArgString: "f", Pos: 6, End: 6, Meta: meta},
+		{Type: ws.Printi, Pos: 7, End: 7},
+		{Type: ws.Ret, Pos: 8, End: 8},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 9)
+	for i := 1; i <= 8; i++ {
+		file.AddLine(i)
+	}
+	p, errs := (&ws.Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	f := p.Blocks[len(p.Blocks)-1]
+	if f.Meta == nil || f.Meta.Stack != meta.Stack || !f.Meta.Pure || !f.Meta.NoReturn {
+		t.Errorf("got block annotations %+v", f.Meta)
+	}
+	FoldConstArith(p)
+	want := []string{
+		"test:3:1: assertion failed: 4 eq 5",
+		"test:8:1: f returns with stack offset -1, but stack signature 1 -> 1 of f has offset 0",
+		"test:7:1: pure routine f performs I/O in f",
+		"test:8:1: noreturn routine f returns in f",
+	}
+	var got []string
+	for _, err := range CheckAnnotations(p) {
+		got = append(got, err.Error())
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got diagnostics:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -38,27 +38,57 @@ func DependenceGraph(block *ir.BasicBlock) graph.Graph {
 // Dependent returns whether two non-branching nodes are dependent. True
 // is returned when node B is dependent on node A. Nodes are dependent
 // when both are I/O instructions, one is I/O and the other can throw,
-// both assign to the same value, or one reads the value assigned to by
-// the other. Dependent is reflexive.
+// one dumps the heap and the other stores to it, one checks heap
+// bounds and the other accesses the heap, both assign to the same
+// value, or one reads the value assigned to by the other. Dependent is
+// reflexive.
 func Dependent(a, b ir.Inst) bool {
 	aIO, bIO := isIO(a), isIO(b)
 	return aIO && bIO ||
 		aIO && canThrow(b) || bIO && canThrow(a) ||
+		dumpsHeap(a) && storesHeap(b) || dumpsHeap(b) && storesHeap(a) ||
+		checksHeap(a) && accessesHeap(b) || checksHeap(b) && accessesHeap(a) ||
 		references(a, b) || references(b, a)
 }
 
 func isIO(inst ir.Inst) bool {
 	switch inst.(type) {
-	case *ir.PrintStmt, *ir.ReadExpr:
+	case *ir.PrintStmt, *ir.ReadExpr, *ir.DebugStmt:
+		return true
+	}
+	return false
+}
+
+func dumpsHeap(inst ir.Inst) bool {
+	debug, ok := inst.(*ir.DebugStmt)
+	return ok && (debug.Op == ir.Trace || debug.Op == ir.DumpHeap)
+}
+
+func storesHeap(inst ir.Inst) bool {
+	_, ok := inst.(*ir.StoreHeapStmt)
+	return ok
+}
+
+func checksHeap(inst ir.Inst) bool {
+	_, ok := inst.(*ir.AccessHeapStmt)
+	return ok
+}
+
+func accessesHeap(inst ir.Inst) bool {
+	switch inst.(type) {
+	case *ir.LoadHeapExpr, *ir.StoreHeapStmt:
 		return true
 	}
 	return false
 }
 
 // canThrow returns whether the node is a division with a non-constant
-// RHS.
+// RHS or a heap bounds check.
 // TODO: create div trap to replace this.
 func canThrow(inst ir.Inst) bool {
+	if checksHeap(inst) {
+		return true
+	}
 	if bin, ok := inst.(*ir.BinaryExpr); ok && bin.Op == ir.Div {
 		_, ok := bin.Operand(1).Def().(*ir.IntConst)
 		return !ok
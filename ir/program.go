@@ -15,6 +15,16 @@ type Program struct {
 	Entry       *BasicBlock
 	NextBlockID int
 	File        *token.File
+	FileSet     *token.FileSet // Set of files when built from multiple files
+}
+
+// Position converts a position in the program source to a
+// token.Position.
+func (p *Program) Position(pos token.Pos) token.Position {
+	if p.FileSet != nil {
+		return p.FileSet.Position(pos)
+	}
+	return p.File.Position(pos)
 }
 
 // TrimUnreachable removes uncalled blocks.
@@ -2,9 +2,11 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"go/token"
+	"io"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -15,6 +17,7 @@ import (
 	"github.com/andrewarchi/nebula/ir/codegen"
 	"github.com/andrewarchi/nebula/ir/optimize"
 	"github.com/andrewarchi/nebula/ws"
+	"github.com/andrewarchi/nebula/wsa"
 )
 
 var (
@@ -22,19 +25,39 @@ var (
 
 	ascii           bool
 	format          string
+	dialect         string
+	encoding        string
+	outEncoding     string
+	strict          bool
+	lang            string
+	outDialect      string
+	foldStrings     bool
+	mapFile         string
+	rawPack         bool
+	packMode        string
+	packSourceMap   bool
 	noFold          bool
 	maxStackLen     uint
 	maxCallStackLen uint
 	maxHeapBound    uint
-
-	commands    map[string]commandConfig
-	packFlags   = flag.NewFlagSet("pack", flag.ExitOnError)
-	unpackFlags = flag.NewFlagSet("unpack", flag.ExitOnError)
-	graphFlags  = flag.NewFlagSet("graph", flag.ExitOnError)
-	astFlags    = flag.NewFlagSet("ast", flag.ExitOnError)
-	irFlags     = flag.NewFlagSet("ir", flag.ExitOnError)
-	llvmFlags   = flag.NewFlagSet("llvm", flag.ExitOnError)
-	helpFlags   = flag.NewFlagSet("help", flag.ExitOnError)
+	cellBits        uint
+	tapeLen         uint
+	checkTape       bool
+	eofMode         string
+	bfDebug         bool
+	bfSeparator     bool
+
+	commands     map[string]commandConfig
+	packFlags    = flag.NewFlagSet("pack", flag.ExitOnError)
+	unpackFlags  = flag.NewFlagSet("unpack", flag.ExitOnError)
+	minifyFlags  = flag.NewFlagSet("minify", flag.ExitOnError)
+	embedFlags   = flag.NewFlagSet("embed", flag.ExitOnError)
+	extractFlags = flag.NewFlagSet("extract", flag.ExitOnError)
+	graphFlags   = flag.NewFlagSet("graph", flag.ExitOnError)
+	astFlags     = flag.NewFlagSet("ast", flag.ExitOnError)
+	irFlags      = flag.NewFlagSet("ir", flag.ExitOnError)
+	llvmFlags    = flag.NewFlagSet("llvm", flag.ExitOnError)
+	helpFlags    = flag.NewFlagSet("help", flag.ExitOnError)
 )
 
 type commandConfig struct {
@@ -53,6 +76,9 @@ The commands are:
 
 	pack    compress program to bit packed format
 	unpack  uncompress program from bit packed format
+	minify  shorten Whitespace program encoding
+	embed   hide program in the whitespace of carrier text
+	extract recover program hidden in text
 	graph   print Nebula IR control flow graph
 	ast     emit Whitespace AST
 	ir      emit Nebula IR
@@ -68,12 +94,15 @@ Examples:
 	%s graph programs/interpret.out.ws | dot -Tpng > graph.png
 
 `
-	packHeader   = "Pack compresses a program to the bit packed format."
-	unpackHeader = "Unpack decompresses a program from the bit packed format."
-	graphHeader  = "Graph prints the control flow graph of a program's Nebula IR."
-	astHeader    = "AST emits a program's AST in Whitespace syntax."
-	irHeader     = "IR emits the Nebula IR of a program."
-	llvmHeader   = "LLVM emits the LLVM IR of a program."
+	packHeader    = "Pack compresses a program to the bit packed .wsx container format.\nWhitespace from stdin (-) or a .ws file is streamed in bits mode,\nunless it has a .map file or -sourcemap is set."
+	minifyHeader  = "Minify emits a program as Whitespace with labels renumbered by use\nfrequency, unused labels dropped, and the shortest stack instructions."
+	embedHeader   = "Embed interleaves a program into the whitespace of a carrier text file\nwithout changing its visible content."
+	extractHeader = "Extract recovers a Whitespace program hidden in text."
+	unpackHeader  = "Unpack decompresses a program from a .wsx container or legacy bit packed format.\nUse - to read from stdin."
+	graphHeader   = "Graph prints the control flow graph of a program's Nebula IR."
+	astHeader     = "AST emits a program's AST in Whitespace syntax. Brainfuck is formatted as\nBrainfuck by default and translated to Whitespace for Whitespace formats."
+	irHeader      = "IR emits the Nebula IR of a program."
+	llvmHeader    = "LLVM emits the LLVM IR of a program."
 )
 
 func main() {
@@ -98,28 +127,52 @@ func usage() {
 
 func initFlags() {
 	commands = map[string]commandConfig{
-		"pack":   {runPack, packFlags},
-		"unpack": {runUnpack, unpackFlags},
-		"graph":  {runGraph, graphFlags},
-		"ast":    {runAST, astFlags},
-		"ir":     {runIR, irFlags},
-		"llvm":   {runLLVM, llvmFlags},
-		"help":   {runHelp, helpFlags},
+		"pack":    {runPack, packFlags},
+		"unpack":  {runUnpack, unpackFlags},
+		"minify":  {runMinify, minifyFlags},
+		"embed":   {runEmbed, embedFlags},
+		"extract": {runExtract, extractFlags},
+		"graph":   {runGraph, graphFlags},
+		"ast":     {runAST, astFlags},
+		"ir":      {runIR, irFlags},
+		"llvm":    {runLLVM, llvmFlags},
+		"help":    {runHelp, helpFlags},
 	}
+	packFlags.BoolVar(&rawPack, "raw", false, "write legacy headerless bitstream without metadata")
+	packFlags.StringVar(&packMode, "mode", "bits", "compression of program in container; options: "+strings.Join(ws.PackModeNames(), ", "))
+	packFlags.BoolVar(&packSourceMap, "sourcemap", false, "include source map of token positions in container")
+	unpackFlags.StringVar(&mapFile, "map", "", "write label names and source map from container to file")
+	minifyFlags.StringVar(&mapFile, "map", "", "write source map of minified program to file")
 	graphFlags.BoolVar(&ascii, "ascii", false, "print as ASCII grid rather than DOT digraph")
-	astFlags.StringVar(&format, "format", "wsa", "output format; options: ws, wsa, wsx, wsapos, wsacomment")
+	astFlags.StringVar(&format, "format", "wsa", "output format; options: ws, wscomment, wsa, wsx, wsapos, wsacomment; for Brainfuck also: bf (default), bfmin, bfindent")
+	astFlags.StringVar(&outDialect, "outdialect", "nebula", "assembly dialect for wsa format; options: "+strings.Join(wsa.DialectNames()[1:], ", "))
+	astFlags.StringVar(&outEncoding, "outencoding", "ws", "Whitespace character encoding for ws format; options: "+strings.Join(ws.EncodingNames(), ", ")+", or custom space,tab,lf")
+	astFlags.StringVar(&mapFile, "map", "", "write source map of Whitespace token offsets to file")
+	astFlags.BoolVar(&foldStrings, "strings", false, "fold character sequences into string pseudo-instructions for wsa format")
 	llvmFlags.UintVar(&maxStackLen, "stack", codegen.DefaultMaxStackLen, "maximum stack length for LLVM codegen")
 	llvmFlags.UintVar(&maxCallStackLen, "calls", codegen.DefaultMaxCallStackLen, "maximum call stack length for LLVM codegen")
 	llvmFlags.UintVar(&maxHeapBound, "heap", codegen.DefaultMaxHeapBound, "maximum heap address bound for LLVM codegen")
 	addIRFlags(graphFlags)
 	addIRFlags(irFlags)
 	addIRFlags(llvmFlags)
-	setUsage(packFlags, "pack <program>", packHeader, false)
-	setUsage(unpackFlags, "unpack <program>", unpackHeader, false)
-	setUsage(graphFlags, "graph [-ascii] [-nofold] <program>", graphHeader, true)
-	setUsage(astFlags, "ast [-format=f] <program>", astHeader, true)
-	setUsage(irFlags, "ir [-nofold] <program>", irHeader, true)
-	setUsage(llvmFlags, "llvm [-nofold] [-stack=n] [-calls=n] [-heap=n] <program>", llvmHeader, true)
+	for _, flags := range []*flag.FlagSet{graphFlags, astFlags, irFlags, llvmFlags} {
+		addBFConfigFlags(flags)
+	}
+	for _, flags := range []*flag.FlagSet{packFlags, minifyFlags, embedFlags, graphFlags, astFlags, irFlags, llvmFlags} {
+		addInputFlags(flags)
+	}
+	for _, flags := range []*flag.FlagSet{graphFlags, astFlags, irFlags, llvmFlags} {
+		addBFFlags(flags)
+	}
+	setUsage(packFlags, "pack [-mode=m] [-raw] [-sourcemap] [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program>", packHeader, true)
+	setUsage(unpackFlags, "unpack [-map=file] <program>", unpackHeader, true)
+	setUsage(minifyFlags, "minify [-map=file] [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program>", minifyHeader, true)
+	setUsage(embedFlags, "embed [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program> <carrier>", embedHeader, true)
+	setUsage(extractFlags, "extract <file>", extractHeader, false)
+	setUsage(graphFlags, "graph [-ascii] [-nofold] [-cell=n] [-tape=n] [-checktape] [-eof=m] [-debug] [-separator] [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program>", graphHeader, true)
+	setUsage(astFlags, "ast [-format=f] [-outdialect=d] [-outencoding=e] [-strings] [-map=file] [-cell=n] [-tape=n] [-checktape] [-eof=m] [-debug] [-separator] [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program>", astHeader, true)
+	setUsage(irFlags, "ir [-nofold] [-cell=n] [-tape=n] [-checktape] [-eof=m] [-debug] [-separator] [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program>", irHeader, true)
+	setUsage(llvmFlags, "llvm [-nofold] [-stack=n] [-calls=n] [-heap=n] [-cell=n] [-tape=n] [-checktape] [-eof=m] [-debug] [-separator] [-dialect=d] [-encoding=e] [-strict] [-lang=l] <program>", llvmHeader, true)
 	helpFlags.Usage = usage
 }
 
@@ -127,6 +180,26 @@ func addIRFlags(flags *flag.FlagSet) {
 	flags.BoolVar(&noFold, "nofold", false, "disable constant folding")
 }
 
+func addBFFlags(flags *flag.FlagSet) {
+	flags.BoolVar(&bfDebug, "debug", false, "lex # in Brainfuck as a dump of the tape")
+	flags.BoolVar(&bfSeparator, "separator", false, "end Brainfuck code at ! and embed the rest of the file as input")
+}
+
+func addBFConfigFlags(flags *flag.FlagSet) {
+	flags.UintVar(&cellBits, "cell", 0, "Brainfuck cell width in bits; options: 8, 16, 32, or 0 for unbounded")
+	flags.UintVar(&tapeLen, "tape", bf.DefaultTapeLen, "Brainfuck tape length in cells, or 0 for unbounded")
+	flags.BoolVar(&checkTape, "checktape", false, "exit with an error when a Brainfuck cell off the tape is accessed")
+	flags.StringVar(&eofMode, "eof", "-1", "value stored by Brainfuck read at EOF; options: "+strings.Join(bf.EOFModeNames(), ", "))
+}
+
+func addInputFlags(flags *flag.FlagSet) {
+	flags.StringVar(&dialect, "dialect", "auto", "Whitespace assembly dialect; options: "+strings.Join(wsa.DialectNames(), ", "))
+	flags.StringVar(&encoding, "encoding", "ws", "Whitespace character encoding; options: "+strings.Join(ws.EncodingNames(), ", ")+", or custom space,tab,lf")
+	flags.BoolVar(&strict, "strict", false, "reject characters in Whitespace that are not instructions")
+	versions, exts := ws.LangNames()
+	flags.StringVar(&lang, "lang", "all", "Whitespace language version with +extensions; versions: "+strings.Join(versions, ", ")+"; extensions: "+strings.Join(exts, ", "))
+}
+
 func setUsage(flags *flag.FlagSet, usage, header string, printFlags bool) {
 	flags.Usage = func() {
 		fmt.Fprintf(os.Stderr, "usage: %s %s\n", name, usage)
@@ -142,78 +215,179 @@ func setUsage(flags *flag.FlagSet, usage, header string, printFlags bool) {
 }
 
 func readFile(args []string) (string, []byte) {
+	filename := inputFilename(args)
+	f := openInput(filename)
+	defer f.Close()
+	src, err := ioutil.ReadAll(f)
+	if err != nil {
+		exitError(err)
+	}
+	return filename, src
+}
+
+func inputFilename(args []string) string {
 	if len(args) == 0 {
 		usageError("No program provided.")
 	}
 	if len(args) != 1 {
 		usageError("Too many arguments provided.")
 	}
-	filename := args[0]
-	src, err := ioutil.ReadFile(filename)
+	return args[0]
+}
+
+// openInput opens the named file, or stdin for "-".
+func openInput(filename string) io.ReadCloser {
+	if filename == "-" {
+		return ioutil.NopCloser(os.Stdin)
+	}
+	f, err := os.Open(filename)
 	if err != nil {
 		exitError(err)
 	}
-	return filename, src
+	return f
 }
 
 func lexWS(src []byte, filename string) *ws.Program {
 	fset := token.NewFileSet()
 	file := fset.AddFile(filename, -1, len(src))
-	tokens, err := ws.LexTokens(file, src)
+	enc, err := ws.ParseEncoding(encoding)
 	if err != nil {
-		exitError(err)
+		usageError(err)
+	}
+	l := &ws.Lexer{Encoding: enc, Strict: strict, Lang: parseLang()}
+	program, err := l.LexProgram(file, src)
+	if err != nil {
+		for _, err := range err.(ws.ErrorList) {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
 	}
-	program := &ws.Program{Tokens: tokens, File: file}
+	program.FileSet = fset
 
-	mapFilename := filename + ".map"
-	if info, err := os.Stat(mapFilename); err == nil && !info.IsDir() {
-		labelMap, err := os.Open(mapFilename)
+	if mapFilename := filename + ".map"; isFile(mapFilename) {
+		f, err := os.Open(mapFilename)
 		if err != nil {
 			exitError(err)
 		}
-		defer labelMap.Close()
-		labelNames, err := ws.ParseLabelMap(labelMap)
+		defer f.Close()
+		sourceMap, err := ws.ParseSourceMap(f)
 		if err != nil {
 			exitError(err)
 		}
-		ws.ApplyLabelMap(tokens, labelNames)
+		if err := program.ApplySourceMap(sourceMap); err != nil {
+			exitError(err)
+		}
 	}
 	return program
 }
 
+// isFile reports whether the named file exists and is not a directory.
+func isFile(filename string) bool {
+	info, err := os.Stat(filename)
+	return err == nil && !info.IsDir()
+}
+
+func lexWSA(src []byte, filename string) *ws.Program {
+	d, ok := wsa.LookupDialect(dialect)
+	if !ok {
+		usageErrorf("Unrecognized dialect: %s", dialect)
+	}
+	program, err := wsa.ParseDialect(token.NewFileSet(), filename, src, d)
+	if err != nil {
+		exitError(err)
+	}
+	program.Lang = parseLang()
+	if errs := program.CheckLang(); len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+	return program
+}
+
+func parseLang() ws.Lang {
+	l, err := ws.ParseLang(lang)
+	if err != nil {
+		usageError(err)
+	}
+	return l
+}
+
+// isBF returns whether the file is Brainfuck or a Brainfuck isomorph
+// by its extension.
+func isBF(filename string) bool {
+	_, ok := bf.LookupExt(filename)
+	return ok
+}
+
 func lexBF(src []byte, filename string) *bf.Program {
 	fset := token.NewFileSet()
 	file := fset.AddFile(filename, -1, len(src))
-	tokens, err := bf.LexTokens(file, src)
+	syntax, _ := bf.LookupExt(filename)
+	l := bf.NewLexer(file, src, syntax)
+	l.Debug = bfDebug
+	l.Separator = bfSeparator
+	program, err := l.LexProgram()
 	if err != nil {
 		exitError(err)
 	}
-	return &bf.Program{Tokens: tokens, File: file}
+	eof, err := bf.ParseEOFMode(eofMode)
+	if err != nil {
+		usageError(err)
+	}
+	config := bf.Config{CellBits: cellBits, TapeLen: tapeLen, CheckBounds: checkTape, EOF: eof}
+	if err := config.Validate(); err != nil {
+		usageError(err)
+	}
+	program.Config = config
+	return program
 }
 
-func lexFileWS(src []byte, filename string) (*ws.Program, []byte) {
+func lexFileWS(src []byte, filename string) *ws.Program {
 	switch {
 	case strings.HasSuffix(filename, ".ws"):
-		return lexWS(src, filename), src
+		return lexWS(src, filename)
 	case strings.HasSuffix(filename, ".wsa"):
-		exitError("WSA lexing not implemented.")
+		return lexWSA(src, filename)
 	case strings.HasSuffix(filename, ".wsx"):
-		src = ws.Unpack(src)
-		return lexWS(src, filename), src
+		c, err := ws.UnpackContainer(src)
+		if err != nil {
+			exitError(err)
+		}
+		program := lexWS(c.Source, filename)
+		if c.Labels != nil {
+			ws.ApplyLabelMap(program.Tokens, c.Labels)
+		}
+		if c.SourceMap != nil {
+			if err := program.ApplySourceMap(c.SourceMap); err != nil {
+				exitError(err)
+			}
+		}
+		return program
 	default:
 		exitError("Unrecognized file type: " + filename)
 	}
 	panic("unreachable")
 }
 
+type irLowerer interface {
+	LowerIR() (*ir.Program, []error)
+}
+
 func convertSSA(args []string) *ir.Program {
+	return lowerSSA(lexProgram(args))
+}
+
+func lexProgram(args []string) irLowerer {
 	filename, src := readFile(args)
-	var program interface{ LowerIR() (*ir.Program, []error) }
-	if strings.HasSuffix(filename, ".bf") {
-		program = lexBF(src, filename)
-	} else {
-		program, _ = lexFileWS(src, filename)
+	if isBF(filename) {
+		return lexBF(src, filename)
 	}
+	return lexFileWS(src, filename)
+}
+
+func lowerSSA(program irLowerer) *ir.Program {
 	ssa, errs := program.LowerIR()
 	if len(errs) != 0 {
 		fatal := false
@@ -231,23 +405,167 @@ func convertSSA(args []string) *ir.Program {
 	if !noFold {
 		optimize.FoldConstArith(ssa)
 	}
+	if errs := optimize.CheckAnnotations(ssa); len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
 	return ssa
 }
 
 func runPack(args []string) {
+	filename := inputFilename(args)
+	isWS := strings.HasSuffix(filename, ".ws") || filename == "-"
+	if rawPack && packSourceMap {
+		usageError("Source map requires a container and cannot be packed raw.")
+	}
+	// Source maps and labels are only stored when the program is lexed.
+	relex := encoding != "ws" || strict || lang != "all" ||
+		!rawPack && (packSourceMap || filename != "-" && isFile(filename+".map"))
+	if isWS && !relex && (rawPack || packMode == "bits") {
+		streamPack(filename)
+		return
+	}
 	filename, src := readFile(args)
+	c := &ws.Container{Source: src}
 	switch {
 	case strings.HasSuffix(filename, ".wsa"):
-		exitError("WSA lexing not implemented.")
+		c = newContainer(lexWSA(src, filename))
+	case isWS && relex:
+		c = newContainer(lexWS(src, filename))
 	case strings.HasSuffix(filename, ".wsx"):
 		usageError("Program is already packed.")
 	}
-	fmt.Print(string(ws.Pack(src)))
+	if rawPack {
+		fmt.Print(string(ws.Pack(c.Source)))
+		return
+	}
+	mode, err := ws.ParsePackMode(packMode)
+	if err != nil {
+		usageError(err)
+	}
+	c.Mode = mode
+	packed := packContainer(c)
+	if mode != ws.BitPacked {
+		c.Mode = ws.BitPacked
+		bitPacked := packContainer(c)
+		fmt.Fprintf(os.Stderr, "%s: %d bytes in %s mode, %.1f%% of %d bytes bit packed\n",
+			filename, len(packed), mode, 100*float64(len(packed))/float64(len(bitPacked)), len(bitPacked))
+	}
+	fmt.Print(string(packed))
+}
+
+func packContainer(c *ws.Container) []byte {
+	packed, err := ws.PackContainer(c)
+	if err != nil {
+		exitError(err)
+	}
+	return packed
+}
+
+// streamPack bit packs Whitespace source from the file to stdout
+// without buffering the program.
+func streamPack(filename string) {
+	in := openInput(filename)
+	defer in.Close()
+	out := bufio.NewWriter(os.Stdout)
+	var w io.WriteCloser = ws.NewEncoder(out)
+	if !rawPack {
+		cw, err := ws.NewContainerWriter(out, &ws.Container{})
+		if err != nil {
+			exitError(err)
+		}
+		w = cw
+	}
+	if _, err := io.Copy(w, in); err != nil {
+		exitError(err)
+	}
+	if err := w.Close(); err != nil {
+		exitError(err)
+	}
+	if err := out.Flush(); err != nil {
+		exitError(err)
+	}
+}
+
+// newContainer constructs a container of the program with its label
+// names and, when requested, its source map.
+func newContainer(program *ws.Program) *ws.Container {
+	m := program.SourceMap(ws.StdEncoding)
+	c := &ws.Container{Source: []byte(program.DumpWS()), Labels: m.Labels}
+	if packSourceMap {
+		c.SourceMap = m
+	}
+	return c
 }
 
 func runUnpack(args []string) {
+	in := openInput(inputFilename(args))
+	defer in.Close()
+	cr, err := ws.NewContainerReader(in)
+	if err != nil {
+		exitError(err)
+	}
+	out := bufio.NewWriter(os.Stdout)
+	_, err = io.Copy(out, cr)
+	if err := out.Flush(); err != nil {
+		exitError(err)
+	}
+	if err != nil {
+		exitError(err)
+	}
+	c := cr.Container
+	if mapFile != "" {
+		m := &ws.SourceMap{Labels: c.Labels}
+		if c.SourceMap != nil {
+			m.Tokens = c.SourceMap.Tokens
+		}
+		writeSourceMap(mapFile, m)
+	}
+}
+
+func runMinify(args []string) {
+	filename, src := readFile(args)
+	if isBF(filename) {
+		usageError("Minify requires a Whitespace program.")
+	}
+	program := lexFileWS(src, filename)
+	program.Minify()
+	fmt.Print(program.DumpWS())
+	if mapFile != "" {
+		writeSourceMap(mapFile, program.SourceMap(ws.StdEncoding))
+	}
+}
+
+func runEmbed(args []string) {
+	if len(args) != 2 {
+		usageError("Program and carrier required.")
+	}
+	filename, src := readFile(args[:1])
+	carrierName, carrier := readFile(args[1:])
+	program := lexFileWS(src, filename)
+	file := token.NewFileSet().AddFile(carrierName, -1, len(carrier))
+	embedded, err := ws.Embed([]byte(program.DumpWS()), file, carrier)
+	if err != nil {
+		exitError(err)
+	}
+	fmt.Print(string(embedded))
+}
+
+func runExtract(args []string) {
 	_, src := readFile(args)
-	fmt.Print(string(ws.Unpack(src)))
+	program, err := ws.Extract(src)
+	if err != nil {
+		if errs, ok := err.(ws.ErrorList); ok {
+			for _, err := range errs {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(1)
+		}
+		exitError(err)
+	}
+	fmt.Print(string(program))
 }
 
 func runGraph(args []string) {
@@ -265,24 +583,106 @@ func runGraph(args []string) {
 
 func runAST(args []string) {
 	filename, src := readFile(args)
-	if strings.HasSuffix(filename, ".bf") {
-		panic("BF printing not implemented")
+	var program *ws.Program
+	if isBF(filename) {
+		bfProgram := lexBF(src, filename)
+		if dumpBF(bfProgram, filename) {
+			return
+		}
+		program = transpileBF(bfProgram)
+	} else {
+		program = lexFileWS(src, filename)
 	}
-	program, src := lexFileWS(src, filename)
+	mapEnc := ws.StdEncoding
 	switch format {
 	case "ws":
-		fmt.Print(program.DumpWS())
+		enc, err := ws.ParseEncoding(outEncoding)
+		if err != nil {
+			usageError(err)
+		}
+		mapEnc = enc
+		fmt.Print(program.DumpWSEncoding(enc))
 	case "wsa":
-		fmt.Print(program.Dump("    "))
+		d, ok := wsa.LookupDialect(outDialect)
+		if !ok || d == wsa.Auto {
+			usageErrorf("Unrecognized output dialect: %s", outDialect)
+		}
+		pr := &wsa.Printer{Dialect: d, Indent: "    ", FoldStrings: foldStrings}
+		out, err := pr.Dump(program)
+		if err != nil {
+			exitError(err)
+		}
+		fmt.Print(out)
 	case "wsx":
-		fmt.Print(string(ws.Pack([]byte(program.DumpWS()))))
+		fmt.Print(string(packContainer(newContainer(program))))
+	case "wscomment":
+		enc, err := ws.ParseEncoding(outEncoding)
+		if err != nil {
+			usageError(err)
+		}
+		fmt.Print(program.DumpSource(enc))
 	case "wsapos":
 		fmt.Print(program.DumpPos())
 	case "wsacomment":
-		fmt.Print(program.DumpCommented(src, "    "))
+		fmt.Print(program.DumpCommented("    "))
 	default:
 		exitErrorf("Unknown format: %s.", format)
 	}
+	if mapFile != "" {
+		writeSourceMap(mapFile, program.SourceMap(mapEnc))
+	}
+}
+
+// dumpBF prints a Brainfuck program in a Brainfuck format and returns
+// whether the format is a Brainfuck format. Brainfuck is formatted
+// canonically when no format is given.
+func dumpBF(program *bf.Program, filename string) bool {
+	bfFormat := "bf"
+	astFlags.Visit(func(f *flag.Flag) {
+		if f.Name == "format" {
+			bfFormat = format
+		}
+	})
+	var style bf.FormatStyle
+	switch bfFormat {
+	case "bf":
+		style = bf.Canonical
+	case "bfmin":
+		style = bf.Minified
+	case "bfindent":
+		style = bf.Indented
+	default:
+		return false
+	}
+	syntax, _ := bf.LookupExt(filename)
+	out := program.Format(syntax, style)
+	if program.Input == nil { // embedded input is printed verbatim
+		out += "\n"
+	}
+	fmt.Print(out)
+	return true
+}
+
+func transpileBF(program *bf.Program) *ws.Program {
+	wsProgram, errs := program.TranspileWS()
+	if len(errs) != 0 {
+		for _, err := range errs {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(1)
+	}
+	return wsProgram
+}
+
+func writeSourceMap(filename string, sourceMap *ws.SourceMap) {
+	f, err := os.Create(filename)
+	if err != nil {
+		exitError(err)
+	}
+	defer f.Close()
+	if err := ws.WriteSourceMap(f, sourceMap); err != nil {
+		exitError(err)
+	}
 }
 
 func runIR(args []string) {
@@ -291,11 +691,15 @@ func runIR(args []string) {
 }
 
 func runLLVM(args []string) {
-	program := convertSSA(args)
-	mod, err := codegen.EmitLLVMModule(program, codegen.Config{
+	program := lexProgram(args)
+	heapBound := maxHeapBound
+	if p, ok := program.(*bf.Program); ok && p.HeapBound() > heapBound {
+		heapBound = p.HeapBound()
+	}
+	mod, err := codegen.EmitLLVMModule(lowerSSA(program), codegen.Config{
 		MaxStackLen:     maxStackLen,
 		MaxCallStackLen: maxCallStackLen,
-		MaxHeapBound:    maxHeapBound,
+		MaxHeapBound:    heapBound,
 	})
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
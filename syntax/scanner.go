@@ -24,8 +24,8 @@ import (
 // by calling the error handler. If no flag is set, comments
 // are ignored.
 const (
-	emitComments uint = 1 << iota // emit all comments
-	semiComment
+	EmitComments uint = 1 << iota // emit all comments
+	SemiComment                   // treat ';' as a line comment
 )
 
 type scanner struct {
@@ -36,9 +36,10 @@ type scanner struct {
 	// current token, valid after calling next()
 	line, col uint
 	blank     bool // line is blank up to col
-	tok       token
+	tok       Token
 	literal   string
-	bad       bool // valid if tok is a literal, true if a syntax error occurred, literal may be malformed
+	op        Operator // valid if tok is Op
+	bad       bool     // valid if tok is a literal, true if a syntax error occurred, literal may be malformed
 }
 
 func (s *scanner) init(src io.Reader, errh func(line, col uint, msg string), mode uint) {
@@ -58,7 +59,7 @@ func (s *scanner) errorAtf(offset int, format string, args ...interface{}) {
 }
 
 // setLiteral sets the scanner state for a recognized literal token.
-func (s *scanner) setLiteral(kind token, ok bool) {
+func (s *scanner) setLiteral(kind Token, ok bool) {
 	s.tok = kind
 	s.literal = string(s.segment())
 	s.bad = !ok
@@ -116,7 +117,7 @@ redo:
 
 	case ';':
 		s.nextch()
-		if s.mode&semiComment == 0 {
+		if s.mode&SemiComment == 0 {
 			s.literal = "semicolon"
 			s.tok = Semi
 			break
@@ -129,6 +130,81 @@ redo:
 		s.nextch()
 		s.tok = Colon
 
+	case '+':
+		s.nextch()
+		s.op, s.tok = Add, Op
+
+	case '-':
+		s.nextch()
+		if s.ch == '>' {
+			s.nextch()
+			s.tok = Arrow
+			break
+		}
+		s.op, s.tok = Sub, Op
+
+	case '*':
+		s.nextch()
+		s.op, s.tok = Mul, Op
+
+	case '%':
+		s.nextch()
+		s.op, s.tok = Rem, Op
+
+	case '(':
+		s.nextch()
+		s.tok = Lparen
+
+	case ')':
+		s.nextch()
+		s.tok = Rparen
+
+	case '<':
+		s.nextch()
+		s.op, s.tok = Lss, Op
+		if s.ch == '=' {
+			s.nextch()
+			s.op = Leq
+		}
+
+	case '>':
+		s.nextch()
+		s.op, s.tok = Gtr, Op
+		if s.ch == '=' {
+			s.nextch()
+			s.op = Geq
+		}
+
+	case '=':
+		s.nextch()
+		if s.ch != '=' {
+			s.errorf("unexpected =; expecting ==")
+			goto redo
+		}
+		s.nextch()
+		s.op, s.tok = Eql, Op
+
+	case '!':
+		s.nextch()
+		if s.ch != '=' {
+			s.errorf("unexpected !; expecting !=")
+			goto redo
+		}
+		s.nextch()
+		s.op, s.tok = Neq, Op
+
+	case '@':
+		s.nextch()
+		s.tok = At
+
+	case '{':
+		s.nextch()
+		s.tok = Lbrace
+
+	case '}':
+		s.nextch()
+		s.tok = Rbrace
+
 	case '.':
 		s.nextch()
 		if isDecimal(s.ch) {
@@ -155,6 +231,7 @@ redo:
 			if !s.lineComment() {
 				goto redo
 			}
+			break
 		}
 		if s.ch == '*' {
 			s.nextch()
@@ -169,7 +246,9 @@ redo:
 			if !keep {
 				goto redo
 			}
+			break
 		}
+		s.op, s.tok = Div, Op
 
 	default:
 		if s.atIdentChar(true) {
@@ -505,7 +584,7 @@ func (s *scanner) skipLine() {
 func (s *scanner) lineComment() (keep bool) {
 	// opening has already been consumed
 
-	if s.mode&emitComments != 0 {
+	if s.mode&EmitComments != 0 {
 		s.skipLine()
 		s.setLiteral(Comment, true)
 		return true
@@ -534,7 +613,7 @@ func (s *scanner) skipBlockComment() (ok bool) {
 func (s *scanner) blockComment() (keep bool) {
 	// opening has already been consumed
 
-	if s.mode&emitComments != 0 {
+	if s.mode&EmitComments != 0 {
 		ok := s.skipBlockComment()
 		s.setLiteral(Comment, ok)
 		return true
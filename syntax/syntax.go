@@ -0,0 +1,59 @@
+// Package syntax implements a scanner for Nebula assembly source files.
+//
+package syntax // import "github.com/andrewarchi/nebula/syntax"
+
+import (
+	"fmt"
+	"io"
+)
+
+// Error describes a syntax error at a source position.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (err Error) Error() string {
+	return fmt.Sprintf("%s: %s", err.Pos, err.Msg)
+}
+
+// ErrorHandler is called for each error encountered while scanning
+// with the one-based line and column of the error.
+type ErrorHandler func(line, col uint, msg string)
+
+// Scanner is a lexical tokenizer for assembly source. After
+// initialization, consecutive calls of Next advance the scanner one
+// token at a time.
+type Scanner struct {
+	scanner
+}
+
+// NewScanner constructs a Scanner that reads from src and reports
+// errors to errh. Mode controls the treatment of comments.
+func NewScanner(src io.Reader, errh ErrorHandler, mode uint) *Scanner {
+	var s Scanner
+	s.init(src, errh, mode)
+	return &s
+}
+
+// Next advances the scanner by reading the next token.
+func (s *Scanner) Next() { s.next() }
+
+// Token returns the kind of the current token.
+func (s *Scanner) Token() Token { return s.tok }
+
+// Literal returns the source text of the current literal token.
+func (s *Scanner) Literal() string { return s.literal }
+
+// Op returns the operator of the current Op token.
+func (s *Scanner) Op() Operator { return s.op }
+
+// Bad returns whether the current literal token is malformed.
+func (s *Scanner) Bad() bool { return s.bad }
+
+// Pos returns the line and column of the start of the current token.
+func (s *Scanner) Pos() (line, col uint) { return s.line, s.col }
+
+// End returns the line and column immediately following the current
+// token.
+func (s *Scanner) End() (line, col uint) { return s.source.pos() }
@@ -1,9 +1,9 @@
 package syntax
 
-type token uint
+type Token uint
 
 const (
-	EOF token = iota + 1
+	EOF Token = iota + 1
 	Ident
 
 	// Literals
@@ -13,11 +13,18 @@ const (
 	String
 	Comment
 
+	Op // operator
+	Lparen
+	Rparen
+	Lbrace
+	Rbrace
+	Arrow // ->
+	At    // @
 	Semi
 	Colon
 )
 
-func (tok token) String() string {
+func (tok Token) String() string {
 	switch tok {
 	case EOF:
 		return "eof"
@@ -33,6 +40,20 @@ func (tok token) String() string {
 		return "string"
 	case Comment:
 		return "comment"
+	case Op:
+		return "op"
+	case Lparen:
+		return "lparen"
+	case Rparen:
+		return "rparen"
+	case Lbrace:
+		return "lbrace"
+	case Rbrace:
+		return "rbrace"
+	case Arrow:
+		return "arrow"
+	case At:
+		return "at"
 	case Semi:
 		return "semi"
 	case Colon:
@@ -41,3 +62,57 @@ func (tok token) String() string {
 		return "badtoken"
 	}
 }
+
+// Operator is the kind of an operator token.
+type Operator uint
+
+// Operators.
+const (
+	_ Operator = iota
+
+	// Additive
+	Add // +
+	Sub // -
+
+	// Multiplicative
+	Mul // *
+	Div // /
+	Rem // %
+
+	// Comparison
+	Eql // ==
+	Neq // !=
+	Lss // <
+	Leq // <=
+	Gtr // >
+	Geq // >=
+)
+
+func (op Operator) String() string {
+	switch op {
+	case Add:
+		return "+"
+	case Sub:
+		return "-"
+	case Mul:
+		return "*"
+	case Div:
+		return "/"
+	case Rem:
+		return "%"
+	case Eql:
+		return "=="
+	case Neq:
+		return "!="
+	case Lss:
+		return "<"
+	case Leq:
+		return "<="
+	case Gtr:
+		return ">"
+	case Geq:
+		return ">="
+	default:
+		return "badop"
+	}
+}
@@ -0,0 +1,301 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/token"
+	"math/big"
+)
+
+// ArithPack compresses a Whitespace source by coding instructions and
+// their arguments with an adaptive binary arithmetic coder. Instruction
+// types are modeled in the context of the previous type and arguments
+// in the context of their type, so no tables are stored. Arguments are
+// coded canonically, so leading zeros are not preserved, and must be
+// shorter than 65536 bits. It is encoded as a uvarint number of tokens
+// followed by the range coded stream.
+func ArithPack(src []byte) ([]byte, error) {
+	file := token.NewFileSet().AddFile("", -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		return nil, err
+	}
+	var n [binary.MaxVarintLen64]byte
+	e := &rangeEncoder{rng: 0xFFFFFFFF, cacheSize: 1}
+	e.out = append(e.out, n[:binary.PutUvarint(n[:], uint64(len(tokens)))]...)
+	m := newArithModel()
+	prev := Illegal
+	for _, tok := range tokens {
+		m.encodeType(e, prev, tok.Type)
+		if tok.Type.HasArg() {
+			if tok.Arg.BitLen() >= maxArgLen {
+				return nil, fmt.Errorf("wsx: %v argument at %v is too large to pack",
+					tok.Type, file.Position(tok.Pos))
+			}
+			m.encodeArg(e, tok.Type, tok.Arg)
+		}
+		prev = tok.Type
+	}
+	return e.flush(), nil
+}
+
+// ArithUnpack expands a source compressed with ArithPack.
+func ArithUnpack(data []byte) ([]byte, error) {
+	r := bytes.NewReader(data)
+	count, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, errArithCorrupt
+	}
+	d := newRangeDecoder(data[len(data)-r.Len():])
+	m := newArithModel()
+	prev := Illegal
+	var b bytes.Buffer
+	for i := uint64(0); i < count; i++ {
+		tok := &Token{Type: m.decodeType(d, prev)}
+		if tok.Type == Illegal || tok.Type > DumpHeap {
+			return nil, errArithCorrupt
+		}
+		if tok.Type.HasArg() {
+			if tok.Arg, err = m.decodeArg(d, tok.Type); err != nil {
+				return nil, err
+			}
+		}
+		if d.overrun() {
+			return nil, errArithCorrupt
+		}
+		b.WriteString(tok.StringWS())
+		prev = tok.Type
+	}
+	return b.Bytes(), nil
+}
+
+var errArithCorrupt = errors.New("wsx: corrupt arithmetic coded program")
+
+const (
+	typeBits    = 5
+	maxArgLen   = 1 << 16 // Exclusive bound of argument bit length
+	lenContexts = 64
+	bitContexts = 64
+	smallArgLen = 8 // Arguments up to this length are modeled by prefix
+)
+
+// arithModel holds the adaptive probabilities for each context.
+type arithModel struct {
+	types [1 << typeBits][1 << typeBits]prob // [prev type][tree node]
+	lens  [1 << typeBits][lenContexts]prob   // [type][length so far]
+	small [1 << typeBits][smallArgLen + 1][1 << smallArgLen]prob
+	large [1 << typeBits][bitContexts]prob // [type][bit index]
+	signs [1 << typeBits]prob
+}
+
+func newArithModel() *arithModel {
+	m := &arithModel{}
+	for typ := range m.types {
+		initProbs(m.types[typ][:])
+		initProbs(m.lens[typ][:])
+		for l := range m.small[typ] {
+			initProbs(m.small[typ][l][:])
+		}
+		initProbs(m.large[typ][:])
+	}
+	initProbs(m.signs[:])
+	return m
+}
+
+func initProbs(probs []prob) {
+	for i := range probs {
+		probs[i] = probInit
+	}
+}
+
+func (m *arithModel) encodeType(e *rangeEncoder, prev, typ Type) {
+	node := 1
+	for i := typeBits - 1; i >= 0; i-- {
+		bit := int(typ>>i) & 1
+		e.encode(&m.types[prev][node], bit)
+		node = node<<1 | bit
+	}
+}
+
+func (m *arithModel) decodeType(d *rangeDecoder, prev Type) Type {
+	node := 1
+	for i := 0; i < typeBits; i++ {
+		node = node<<1 | d.decode(&m.types[prev][node])
+	}
+	return Type(node - 1<<typeBits)
+}
+
+// encodeArg codes the bit length of the argument in unary, followed by
+// the bits below the leading one and the sign.
+func (m *arithModel) encodeArg(e *rangeEncoder, typ Type, arg *big.Int) {
+	mag := new(big.Int).Abs(arg)
+	l := mag.BitLen()
+	for i := 0; i < l; i++ {
+		e.encode(&m.lens[typ][lenContext(i)], 1)
+	}
+	e.encode(&m.lens[typ][lenContext(l)], 0)
+	node := 1
+	for i := l - 2; i >= 0; i-- {
+		bit := int(mag.Bit(i))
+		e.encode(m.bitProb(typ, l, i, node), bit)
+		node = node<<1 | bit
+	}
+	if !typ.IsControl() && l != 0 {
+		sign := 0
+		if arg.Sign() < 0 {
+			sign = 1
+		}
+		e.encode(&m.signs[typ], sign)
+	}
+}
+
+func (m *arithModel) decodeArg(d *rangeDecoder, typ Type) (*big.Int, error) {
+	l := 0
+	for d.decode(&m.lens[typ][lenContext(l)]) == 1 {
+		l++
+		if l >= maxArgLen || d.overrun() {
+			return nil, errArithCorrupt
+		}
+	}
+	arg := new(big.Int)
+	if l == 0 {
+		return arg, nil
+	}
+	arg.SetBit(arg, l-1, 1)
+	node := 1
+	for i := l - 2; i >= 0; i-- {
+		bit := d.decode(m.bitProb(typ, l, i, node))
+		arg.SetBit(arg, i, uint(bit))
+		node = node<<1 | bit
+	}
+	if !typ.IsControl() && d.decode(&m.signs[typ]) == 1 {
+		arg.Neg(arg)
+	}
+	return arg, nil
+}
+
+func lenContext(l int) int {
+	if l >= lenContexts {
+		return lenContexts - 1
+	}
+	return l
+}
+
+// bitProb returns the context for bit i of an argument of length l.
+// Short arguments, such as characters, are modeled by the preceding
+// bits and long arguments by position.
+func (m *arithModel) bitProb(typ Type, l, i, node int) *prob {
+	if l <= smallArgLen {
+		return &m.small[typ][l][node]
+	}
+	if i >= bitContexts {
+		i = bitContexts - 1
+	}
+	return &m.large[typ][i]
+}
+
+// prob is the probability of a zero bit, scaled by probTotal.
+type prob uint16
+
+const (
+	probBits  = 11
+	probTotal = 1 << probBits
+	probInit  = probTotal / 2
+	moveBits  = 5
+)
+
+// rangeEncoder is a binary range coder in the style of LZMA.
+type rangeEncoder struct {
+	low       uint64
+	rng       uint32
+	cache     byte
+	cacheSize int
+	out       []byte
+}
+
+func (e *rangeEncoder) encode(p *prob, bit int) {
+	bound := (e.rng >> probBits) * uint32(*p)
+	if bit == 0 {
+		e.rng = bound
+		*p += (probTotal - *p) >> moveBits
+	} else {
+		e.low += uint64(bound)
+		e.rng -= bound
+		*p -= *p >> moveBits
+	}
+	for e.rng < 1<<24 {
+		e.rng <<= 8
+		e.shiftLow()
+	}
+}
+
+func (e *rangeEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low>>32 != 0 {
+		carry := byte(e.low >> 32)
+		temp := e.cache
+		for ; e.cacheSize != 0; e.cacheSize-- {
+			e.out = append(e.out, temp+carry)
+			temp = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00FFFFFF) << 8
+}
+
+func (e *rangeEncoder) flush() []byte {
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out
+}
+
+type rangeDecoder struct {
+	code uint32
+	rng  uint32
+	in   []byte
+	pos  int
+}
+
+func newRangeDecoder(in []byte) *rangeDecoder {
+	d := &rangeDecoder{rng: 0xFFFFFFFF, in: in}
+	for i := 0; i < 5; i++ {
+		d.code = d.code<<8 | uint32(d.next())
+	}
+	return d
+}
+
+func (d *rangeDecoder) next() byte {
+	d.pos++
+	if d.pos > len(d.in) {
+		return 0
+	}
+	return d.in[d.pos-1]
+}
+
+// overrun returns whether the decoder has read past the end of the
+// input by more than the flushed bytes.
+func (d *rangeDecoder) overrun() bool {
+	return d.pos > len(d.in)+4
+}
+
+func (d *rangeDecoder) decode(p *prob) int {
+	bound := (d.rng >> probBits) * uint32(*p)
+	var bit int
+	if d.code < bound {
+		d.rng = bound
+		*p += (probTotal - *p) >> moveBits
+	} else {
+		d.code -= bound
+		d.rng -= bound
+		*p -= *p >> moveBits
+		bit = 1
+	}
+	for d.rng < 1<<24 {
+		d.rng <<= 8
+		d.code = d.code<<8 | uint32(d.next())
+	}
+	return bit
+}
@@ -0,0 +1,94 @@
+package ws
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestArithPack(t *testing.T) {
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890", 10)
+	p := &Program{Tokens: []*Token{
+		{Type: Label, Arg: big.NewInt(0)},
+		{Type: Push, Arg: big.NewInt(72)},
+		{Type: Printc},
+		{Type: Push, Arg: big.NewInt(-100)},
+		{Type: Push, Arg: big.NewInt(0)},
+		{Type: Push, Arg: huge},
+		{Type: Copy, Arg: big.NewInt(2)},
+		{Type: Slide, Arg: big.NewInt(-1)},
+		{Type: Call, Arg: big.NewInt(1000)},
+		{Type: Jmp, Arg: big.NewInt(0)},
+		{Type: Label, Arg: big.NewInt(1000)},
+		{Type: DumpHeap},
+		{Type: Ret},
+	}}
+	src := []byte(p.DumpWS())
+	packed, err := ArithPack(src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	unpacked, err := ArithUnpack(packed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(unpacked) != string(src) {
+		t.Errorf("got %q, want %q", unpacked, src)
+	}
+}
+
+func TestArithPackPrograms(t *testing.T) {
+	srcs := []string{"", "\n\n\n", "   \t\n\t\n  "}
+	for _, src := range srcs {
+		packed, err := ArithPack([]byte(src))
+		if err != nil {
+			t.Errorf("ArithPack(%q): unexpected error: %v", src, err)
+			continue
+		}
+		unpacked, err := ArithUnpack(packed)
+		if err != nil || string(unpacked) != src {
+			t.Errorf("ArithUnpack(ArithPack(%q)) = %q, %v", src, unpacked, err)
+		}
+	}
+	if _, err := ArithPack([]byte("\t\t\n")); err == nil {
+		t.Error("ArithPack of invalid source: expected error")
+	}
+	long := "   \t" + strings.Repeat(" ", maxArgLen-2) + "\n"
+	if packed, err := ArithPack([]byte(long)); err != nil {
+		t.Errorf("ArithPack of %d-bit argument: unexpected error: %v", maxArgLen-1, err)
+	} else if unpacked, err := ArithUnpack(packed); err != nil || string(unpacked) != long {
+		t.Errorf("ArithUnpack of %d-bit argument: got %d bytes, %v", maxArgLen-1, len(unpacked), err)
+	}
+	for _, bits := range []int{maxArgLen, 70000} {
+		src := "   \t" + strings.Repeat(" ", bits-1) + "\n"
+		if _, err := ArithPack([]byte(src)); err == nil {
+			t.Errorf("ArithPack of %d-bit argument: expected error", bits)
+		}
+	}
+	for _, data := range [][]byte{{0xff}, {0x80, 0x80, 0x01}} {
+		if _, err := ArithUnpack(data); err != errArithCorrupt {
+			t.Errorf("ArithUnpack(%x): got error %v, want %v", data, err, errArithCorrupt)
+		}
+	}
+}
+
+func TestArithContainer(t *testing.T) {
+	src := []byte("   \t\n\t\n  \n\n\n")
+	packed, err := PackContainer(&Container{Source: src, Mode: Arithmetic})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c, err := UnpackContainer(packed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Mode != Arithmetic || string(c.Source) != string(src) {
+		t.Errorf("got mode %v source %q, want arith %q", c.Mode, c.Source, src)
+	}
+	if _, err := ParsePackMode("arith"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := ParsePackMode("zip"); err == nil {
+		t.Error("ParsePackMode(zip): expected error")
+	}
+}
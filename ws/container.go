@@ -0,0 +1,348 @@
+package ws
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+)
+
+// Container is a bit packed Whitespace program with optional metadata.
+// It is encoded as:
+//
+//	magic    "\x89WSX"
+//	version  byte
+//	sections kind byte, uvarint length, data
+//	checksum big-endian CRC-32 (IEEE) of the preceding bytes
+//
+// A program section, either bit packed or arithmetic coded, is required
+// and label and source map sections are optional. Unknown sections are
+// skipped. A streamed program section has no length and extends to the
+// checksum, so it must be the last section.
+type Container struct {
+	Version   byte
+	Mode      PackMode    // Compression of program section
+	Source    []byte      // Unpacked Whitespace source
+	Labels    *bigint.Map // map[*big.Int]string; label names, if any
+	SourceMap *SourceMap  // Token positions in assembly, if any
+}
+
+// ContainerVersion is the current container format version. Version 0
+// denotes the legacy headerless bitstream.
+const ContainerVersion = 1
+
+var containerMagic = []byte("\x89WSX")
+
+// Container section kinds.
+const (
+	sectionProgram byte = iota + 1
+	sectionLabels
+	sectionSourceMap
+	sectionArith
+	sectionStream
+)
+
+// PackMode is the compression of the program in a container.
+type PackMode uint8
+
+// Pack modes.
+const (
+	BitPacked  PackMode = iota // 1 or 2 bits per character
+	Arithmetic                 // Arithmetic coded instructions
+)
+
+var packModeNames = []string{"bits", "arith"}
+
+// ParsePackMode looks up a pack mode by name.
+func ParsePackMode(name string) (PackMode, error) {
+	for mode, modeName := range packModeNames {
+		if name == modeName {
+			return PackMode(mode), nil
+		}
+	}
+	return 0, fmt.Errorf("unrecognized pack mode: %s", name)
+}
+
+// PackModeNames returns the names of all pack modes.
+func PackModeNames() []string {
+	return append([]string{}, packModeNames...)
+}
+
+func (mode PackMode) String() string {
+	if int(mode) < len(packModeNames) {
+		return packModeNames[mode]
+	}
+	return fmt.Sprintf("PackMode(%d)", mode)
+}
+
+// PackContainer compresses the source of the container in its mode and
+// encodes it with its metadata in the current container version.
+func PackContainer(c *Container) ([]byte, error) {
+	var b bytes.Buffer
+	writeHeader(&b, c)
+	switch c.Mode {
+	case BitPacked:
+		writeSection(&b, sectionProgram, Pack(c.Source))
+	case Arithmetic:
+		data, err := ArithPack(c.Source)
+		if err != nil {
+			return nil, err
+		}
+		writeSection(&b, sectionArith, data)
+	default:
+		return nil, fmt.Errorf("wsx: unsupported pack mode: %v", c.Mode)
+	}
+	var sum [crc32.Size]byte
+	binary.BigEndian.PutUint32(sum[:], crc32.ChecksumIEEE(b.Bytes()))
+	b.Write(sum[:])
+	return b.Bytes(), nil
+}
+
+// writeHeader writes the magic, version, and metadata sections of the
+// container.
+func writeHeader(b *bytes.Buffer, c *Container) {
+	b.Write(containerMagic)
+	b.WriteByte(ContainerVersion)
+	if c.Labels != nil && c.Labels.Len() != 0 {
+		var labels bytes.Buffer
+		writeLabels(&labels, c.Labels)
+		writeSection(b, sectionLabels, labels.Bytes())
+	}
+	if c.SourceMap != nil {
+		var m bytes.Buffer
+		WriteSourceMap(&m, &SourceMap{Tokens: c.SourceMap.Tokens})
+		writeSection(b, sectionSourceMap, m.Bytes())
+	}
+}
+
+func writeSection(b *bytes.Buffer, kind byte, data []byte) {
+	var n [binary.MaxVarintLen64]byte
+	b.WriteByte(kind)
+	b.Write(n[:binary.PutUvarint(n[:], uint64(len(data)))])
+	b.Write(data)
+}
+
+func writeLabels(b *bytes.Buffer, labels *bigint.Map) {
+	for _, pair := range labels.Pairs() {
+		fmt.Fprintf(b, "%s:%s\n", pair.K, pair.V)
+	}
+}
+
+// ContainerWriter streams Whitespace source written to it into a
+// container with a streamed bit packed program section.
+type ContainerWriter struct {
+	w   io.Writer
+	crc hash.Hash32
+	enc *Encoder
+}
+
+// NewContainerWriter writes the header and metadata of c to w and
+// constructs a ContainerWriter for its source. The source of c is
+// ignored and only the bit packed mode can be streamed. Close must be
+// called to write the checksum.
+func NewContainerWriter(w io.Writer, c *Container) (*ContainerWriter, error) {
+	if c.Mode != BitPacked {
+		return nil, fmt.Errorf("wsx: %v mode cannot be streamed", c.Mode)
+	}
+	var b bytes.Buffer
+	writeHeader(&b, c)
+	b.WriteByte(sectionStream)
+	crc := crc32.NewIEEE()
+	crc.Write(b.Bytes())
+	if _, err := w.Write(b.Bytes()); err != nil {
+		return nil, err
+	}
+	return &ContainerWriter{w, crc, NewEncoder(io.MultiWriter(w, crc))}, nil
+}
+
+// Write packs the Whitespace characters in p.
+func (cw *ContainerWriter) Write(p []byte) (int, error) {
+	return cw.enc.Write(p)
+}
+
+// Close writes the final byte of the program and the checksum. It does
+// not close the underlying writer.
+func (cw *ContainerWriter) Close() error {
+	if err := cw.enc.Close(); err != nil {
+		return err
+	}
+	var sum [crc32.Size]byte
+	binary.BigEndian.PutUint32(sum[:], cw.crc.Sum32())
+	_, err := cw.w.Write(sum[:])
+	return err
+}
+
+// UnpackContainer decodes a container and unpacks its source. Data
+// without the container magic is read as a legacy headerless
+// bitstream.
+func UnpackContainer(data []byte) (*Container, error) {
+	cr, err := NewContainerReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	src, err := ioutil.ReadAll(cr)
+	if err != nil {
+		return nil, err
+	}
+	c := cr.Container
+	c.Source = src
+	return c, nil
+}
+
+// ContainerReader reads the unpacked source of a container. A streamed
+// program is unpacked as it is read and its checksum is verified when
+// the end is reached.
+type ContainerReader struct {
+	Container *Container // Container metadata, without source
+	src       io.Reader
+	tr        *trailerReader
+}
+
+// NewContainerReader reads the header and sections of a container
+// preceding a streamed program. When the program is not streamed, the
+// entire container is read and verified. Data without the container
+// magic is read as a legacy headerless bitstream.
+func NewContainerReader(r io.Reader) (*ContainerReader, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(len(containerMagic)); !bytes.Equal(magic, containerMagic) {
+		return &ContainerReader{Container: &Container{}, src: NewDecoder(br)}, nil
+	}
+	tr := &trailerReader{r: br, crc: crc32.NewIEEE()}
+	cr := &ContainerReader{Container: &Container{}, tr: tr}
+	if err := cr.readSections(bufio.NewReader(tr)); err != nil {
+		// Report corruption in preference to malformed sections.
+		if err == errTruncated {
+			return nil, err
+		}
+		if _, err := io.Copy(ioutil.Discard, tr); err == nil && !tr.valid() {
+			return nil, errChecksum
+		}
+		return nil, err
+	}
+	return cr, nil
+}
+
+var (
+	errChecksum  = errors.New("wsx: checksum mismatch")
+	errTruncated = errors.New("wsx: truncated container")
+)
+
+func (cr *ContainerReader) readSections(r *bufio.Reader) error {
+	header := make([]byte, len(containerMagic)+1)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return errTruncated
+	}
+	c := cr.Container
+	c.Version = header[len(containerMagic)]
+	if c.Version != ContainerVersion {
+		return fmt.Errorf("wsx: unsupported version %d", c.Version)
+	}
+	for {
+		kind, err := r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if kind == sectionStream {
+			c.Mode = BitPacked
+			cr.src = NewDecoder(r)
+			return nil
+		}
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errors.New("wsx: truncated section")
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(r, int64(n)))
+		if err != nil {
+			return err
+		} else if uint64(len(data)) != n {
+			return errors.New("wsx: truncated section")
+		}
+		switch kind {
+		case sectionProgram:
+			c.Mode = BitPacked
+			cr.src = bytes.NewReader(Unpack(data))
+		case sectionArith:
+			src, err := ArithUnpack(data)
+			if err != nil {
+				return err
+			}
+			c.Mode = Arithmetic
+			cr.src = bytes.NewReader(src)
+		case sectionLabels:
+			if c.Labels, err = ParseLabelMap(bytes.NewReader(data)); err != nil {
+				return fmt.Errorf("wsx: labels: %v", err)
+			}
+		case sectionSourceMap:
+			if c.SourceMap, err = ParseSourceMap(bytes.NewReader(data)); err != nil {
+				return fmt.Errorf("wsx: %v", err)
+			}
+		}
+	}
+	if !cr.tr.valid() {
+		return errChecksum
+	}
+	if cr.src == nil {
+		return errors.New("wsx: missing program section")
+	}
+	return nil
+}
+
+// Read reads unpacked Whitespace source into p.
+func (cr *ContainerReader) Read(p []byte) (int, error) {
+	n, err := cr.src.Read(p)
+	if err == io.EOF && cr.tr != nil {
+		if _, err := io.Copy(ioutil.Discard, cr.tr); err != nil {
+			return n, err
+		}
+		if !cr.tr.valid() {
+			return n, errChecksum
+		}
+	}
+	return n, err
+}
+
+// trailerReader reads from r, withholding the checksum at the end and
+// computing the checksum of the bytes preceding it.
+type trailerReader struct {
+	r   io.Reader
+	buf []byte
+	eof bool
+	crc hash.Hash32
+}
+
+func (tr *trailerReader) Read(p []byte) (int, error) {
+	for !tr.eof && len(tr.buf) < len(p)+crc32.Size {
+		chunk := make([]byte, len(p)+crc32.Size-len(tr.buf))
+		n, err := tr.r.Read(chunk)
+		tr.buf = append(tr.buf, chunk[:n]...)
+		if err == io.EOF {
+			tr.eof = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n := len(tr.buf) - crc32.Size
+	if n <= 0 {
+		return 0, io.EOF
+	}
+	n = copy(p, tr.buf[:n])
+	tr.crc.Write(tr.buf[:n])
+	tr.buf = tr.buf[n:]
+	return n, nil
+}
+
+// valid returns whether the reader is at the end and the checksum
+// matches.
+func (tr *trailerReader) valid() bool {
+	return tr.eof && len(tr.buf) == crc32.Size &&
+		binary.BigEndian.Uint32(tr.buf) == tr.crc.Sum32()
+}
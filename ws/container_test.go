@@ -0,0 +1,149 @@
+package ws
+
+import (
+	"bytes"
+	"go/token"
+	"hash/crc32"
+	"io/ioutil"
+	"math/big"
+	"testing"
+	"testing/iotest"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+)
+
+func TestContainer(t *testing.T) {
+	labels := bigint.NewMap()
+	labels.Put(big.NewInt(0), "start")
+	sourceMap := &SourceMap{Tokens: []MappedToken{
+		{Offset: 0, Pos: token.Position{Filename: "prog.wsa", Line: 1, Column: 1}},
+		{Offset: 4, Pos: token.Position{Filename: "prog.wsa", Line: 2, Column: 5},
+			Expansion: []MappedExpansion{{"twice", token.Position{Filename: "prog.wsa", Line: 4, Column: 3}}}},
+	}}
+	src := []byte("\n  \n \t \t\n\n\n")
+	packed, err := PackContainer(&Container{Source: src, Labels: labels, SourceMap: sourceMap})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.HasPrefix(packed, []byte("\x89WSX\x01")) {
+		t.Errorf("got header %q, want magic and version", packed[:5])
+	}
+	c, err := UnpackContainer(packed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if c.Version != ContainerVersion {
+		t.Errorf("got version %d, want %d", c.Version, ContainerVersion)
+	}
+	if string(c.Source) != string(src) {
+		t.Errorf("got source %q, want %q", c.Source, src)
+	}
+	if name, ok := c.Labels.Get(big.NewInt(0)); !ok || name != "start" {
+		t.Errorf("got label %v, want start", name)
+	}
+	if c.SourceMap == nil || len(c.SourceMap.Tokens) != 2 ||
+		c.SourceMap.Tokens[1].Pos != sourceMap.Tokens[1].Pos ||
+		len(c.SourceMap.Tokens[1].Expansion) != 1 {
+		t.Errorf("got source map %+v, want %+v", c.SourceMap, sourceMap)
+	}
+}
+
+func TestContainerLegacy(t *testing.T) {
+	for i, test := range tests {
+		c, err := UnpackContainer(test.packed)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %v", i, err)
+			continue
+		}
+		if c.Version != 0 || string(c.Source) != string(test.unpacked) {
+			t.Errorf("test %d: got version %d source %b, want version 0 source %b", i, c.Version, c.Source, test.unpacked)
+		}
+	}
+}
+
+func TestContainerErrors(t *testing.T) {
+	packed, err := PackContainer(&Container{Source: []byte("\n\n\n")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	corrupt := append([]byte{}, packed...)
+	corrupt[6] ^= 0xff
+	version := append([]byte{}, packed[:len(packed)-4]...)
+	version[4] = 2
+	version = appendChecksum(version)
+	truncated := appendChecksum([]byte("\x89WSX\x01\x01\x05\xff"))
+	empty := appendChecksum([]byte("\x89WSX\x01"))
+	tests := []struct {
+		data []byte
+		err  string
+	}{
+		{corrupt, "wsx: checksum mismatch"},
+		{version, "wsx: unsupported version 2"},
+		{truncated, "wsx: truncated section"},
+		{empty, "wsx: missing program section"},
+		{[]byte("\x89WSX\x01"), "wsx: truncated container"},
+	}
+	for i, tt := range tests {
+		_, err := UnpackContainer(tt.data)
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("test %d: got error %v, want %q", i, err, tt.err)
+		}
+	}
+}
+
+func appendChecksum(b []byte) []byte {
+	sum := crc32.ChecksumIEEE(b)
+	return append(b, byte(sum>>24), byte(sum>>16), byte(sum>>8), byte(sum))
+}
+
+func TestContainerStream(t *testing.T) {
+	labels := bigint.NewMap()
+	labels.Put(big.NewInt(1), "loop")
+	src := []byte("   \t\n\n  \t\n\t\n  \n \n\t\n\n\n")
+	var b bytes.Buffer
+	cw, err := NewContainerWriter(&b, &Container{Labels: labels})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range src {
+		cw.Write(src[i : i+1])
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	packed := b.Bytes()
+
+	cr, err := NewContainerReader(iotest.OneByteReader(bytes.NewReader(packed)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if name, ok := cr.Container.Labels.Get(big.NewInt(1)); !ok || name != "loop" {
+		t.Errorf("got label %v, want loop", name)
+	}
+	u, err := ioutil.ReadAll(cr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(u) != string(src) {
+		t.Errorf("got source %q, want %q", u, src)
+	}
+
+	c, err := UnpackContainer(packed)
+	if err != nil || string(c.Source) != string(src) {
+		t.Errorf("UnpackContainer: got %q, %v, want %q", c.Source, err, src)
+	}
+
+	corrupt := append([]byte{}, packed...)
+	corrupt[len(corrupt)-5] ^= 0x01
+	cr, err = NewContainerReader(bytes.NewReader(corrupt))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := ioutil.ReadAll(cr); err != errChecksum {
+		t.Errorf("got error %v, want %v", err, errChecksum)
+	}
+
+	if _, err := NewContainerWriter(&b, &Container{Mode: Arithmetic}); err == nil {
+		t.Error("NewContainerWriter in arith mode: expected error")
+	}
+}
@@ -0,0 +1,66 @@
+package ws
+
+import (
+	"bytes"
+	"fmt"
+	"go/token"
+)
+
+// Embed interleaves the space, tab, and LF characters of a Whitespace
+// program into carrier text without changing its non-whitespace
+// content. The whitespace of the carrier is kept, so it must occur in
+// order within the program; program characters are inserted before
+// each carrier whitespace character until it matches and the remainder
+// is appended. Errors are positioned in the carrier file. An error is
+// returned when whitespace in the carrier would corrupt the program.
+func Embed(src []byte, file *token.File, carrier []byte) ([]byte, error) {
+	prog := make([]byte, 0, len(src))
+	for _, c := range src {
+		if c == space || c == tab || c == lf {
+			prog = append(prog, c)
+		}
+	}
+	file.SetLinesForContent(carrier)
+	var b bytes.Buffer
+	i := 0
+	for offset, c := range carrier {
+		if c == space || c == tab || c == lf {
+			j := bytes.IndexByte(prog[i:], c)
+			if j == -1 {
+				return nil, fmt.Errorf("embed: carrier whitespace %q at %v would corrupt program",
+					c, file.Position(file.Pos(offset)))
+			}
+			b.Write(prog[i : i+j+1])
+			i += j + 1
+			continue
+		}
+		b.WriteByte(c)
+	}
+	b.Write(prog[i:])
+
+	// Verify that the embedded program lexes as the original.
+	embedded := b.Bytes()
+	got, err := Extract(embedded)
+	if err != nil {
+		return nil, fmt.Errorf("embed: %v", err)
+	}
+	if !bytes.Equal(got, prog) {
+		return nil, fmt.Errorf("embed: embedded program does not match")
+	}
+	return embedded, nil
+}
+
+// Extract lexes a Whitespace program hidden in text and returns it
+// with the text removed.
+func Extract(text []byte) ([]byte, error) {
+	file := token.NewFileSet().AddFile("", -1, len(text))
+	tokens, err := LexTokens(file, text)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	for _, tok := range tokens {
+		b.WriteString(tok.sourceWS())
+	}
+	return b.Bytes(), nil
+}
@@ -0,0 +1,41 @@
+package ws
+
+import (
+	"go/token"
+	"testing"
+)
+
+func TestEmbed(t *testing.T) {
+	src := "   \t\n\t\n \t\n\n\n" // push 1; printi; end
+	carrier := "Hello,\tworld!\n"
+	file := token.NewFileSet().AddFile("carrier.txt", -1, len(carrier))
+	embedded, err := Embed([]byte(src), file, []byte(carrier))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "Hello,   \tworld!\n\t\n \t\n\n\n"
+	if string(embedded) != want {
+		t.Errorf("got %q, want %q", embedded, want)
+	}
+	extracted, err := Extract(embedded)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(extracted) != src {
+		t.Errorf("got %q, want %q", extracted, src)
+	}
+}
+
+func TestEmbedCorrupt(t *testing.T) {
+	src := "\n\n\n" // end
+	carrier := "a b\n"
+	file := token.NewFileSet().AddFile("carrier.txt", -1, len(carrier))
+	_, err := Embed([]byte(src), file, []byte(carrier))
+	want := `embed: carrier whitespace ' ' at carrier.txt:1:2 would corrupt program`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+	if _, err := Extract([]byte("\t\t\n")); err == nil {
+		t.Error("Extract: expected error")
+	}
+}
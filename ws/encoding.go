@@ -0,0 +1,121 @@
+package ws
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Encoding maps the Whitespace characters space, tab, and LF to
+// symbols, so that programs can be written visibly. When a symbol is
+// not itself whitespace, whitespace in source is treated as a comment
+// and can be used for formatting.
+type Encoding struct {
+	Space string
+	Tab   string
+	LF    string
+}
+
+// Predefined encodings.
+var (
+	StdEncoding     = &Encoding{" ", "\t", "\n"}            // Whitespace characters
+	STLEncoding     = &Encoding{"S", "T", "L"}              // Letter notation
+	BracketEncoding = &Encoding{"[Space]", "[Tab]", "[LF]"} // Bracketed names
+)
+
+var encodingNames = []struct {
+	Name string
+	Enc  *Encoding
+}{
+	{"ws", StdEncoding},
+	{"stl", STLEncoding},
+	{"bracket", BracketEncoding},
+}
+
+// NewEncoding constructs an encoding from the symbols for space, tab,
+// and LF. Symbols must be non-empty and no symbol may be a prefix of
+// another.
+func NewEncoding(space, tab, lf string) (*Encoding, error) {
+	enc := &Encoding{space, tab, lf}
+	syms := enc.symbols()
+	for i, a := range syms {
+		if a == "" {
+			return nil, fmt.Errorf("ws: encoding has empty symbol")
+		}
+		for j, b := range syms {
+			if i != j && strings.HasPrefix(b, a) {
+				return nil, fmt.Errorf("ws: encoding symbol %q is a prefix of %q", a, b)
+			}
+		}
+	}
+	return enc, nil
+}
+
+// ParseEncoding returns the encoding with the given name, which is one
+// of ws, stl, or bracket, or parses a custom encoding of three symbols
+// separated by commas. Symbols may contain Go escape sequences, such as
+// `\u2002,\u2003,\u2028` for en space, em space, and line separator.
+func ParseEncoding(spec string) (*Encoding, error) {
+	for _, e := range encodingNames {
+		if spec == e.Name {
+			return e.Enc, nil
+		}
+	}
+	fields := strings.Split(spec, ",")
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("ws: unrecognized encoding: %s", spec)
+	}
+	for i, field := range fields {
+		sym, err := strconv.Unquote(`"` + field + `"`)
+		if err != nil {
+			return nil, fmt.Errorf("ws: invalid encoding symbol: %s", field)
+		}
+		fields[i] = sym
+	}
+	return NewEncoding(fields[0], fields[1], fields[2])
+}
+
+// EncodingNames returns the names of the predefined encodings.
+func EncodingNames() []string {
+	names := make([]string, len(encodingNames))
+	for i, e := range encodingNames {
+		names[i] = e.Name
+	}
+	return names
+}
+
+func (enc *Encoding) symbols() [3]string {
+	return [3]string{enc.Space, enc.Tab, enc.LF}
+}
+
+// isVisible reports whether no symbol contains whitespace.
+func (enc *Encoding) isVisible() bool {
+	for _, sym := range enc.symbols() {
+		if strings.ContainsAny(sym, " \t\n") {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode replaces space, tab, and LF in Whitespace source with the
+// symbols of the encoding. Other characters are unchanged.
+func (enc *Encoding) Encode(src string) string {
+	if enc == StdEncoding {
+		return src
+	}
+	var b strings.Builder
+	for _, c := range src {
+		switch c {
+		case space:
+			b.WriteString(enc.Space)
+		case tab:
+			b.WriteString(enc.Tab)
+		case lf:
+			b.WriteString(enc.LF)
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package ws
+
+import (
+	"go/token"
+	"testing"
+)
+
+func TestEncoding(t *testing.T) {
+	src := "   \t\n \n \t\n  \n\n\n"
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	program := &Program{Tokens: tokens, File: file}
+	tests := []struct {
+		Enc  *Encoding
+		Want string
+	}{
+		{StdEncoding, src},
+		{STLEncoding, "SSSTL\nSLS\nTLSS\nLLL\n"},
+		{BracketEncoding, "[Space][Space][Space][Tab][LF]\n[Space][LF][Space]\n[Tab][LF][Space][Space]\n[LF][LF][LF]\n"},
+		{&Encoding{"\u2002", "\u2003", "\u2028"}, "\u2002\u2002\u2002\u2003\u2028\n\u2002\u2028\u2002\n\u2003\u2028\u2002\u2002\n\u2028\u2028\u2028\n"},
+	}
+	for _, test := range tests {
+		got := program.DumpWSEncoding(test.Enc)
+		if got != test.Want {
+			t.Errorf("DumpWSEncoding(%q) = %q, want %q", test.Enc.symbols(), got, test.Want)
+			continue
+		}
+		// Round trip, with a comment that is not a symbol
+		encoded := "#" + got
+		file := token.NewFileSet().AddFile("test", -1, len(encoded))
+		tokens, err := (&Lexer{Encoding: test.Enc}).LexTokens(file, []byte(encoded))
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", test.Enc.symbols(), err)
+			continue
+		}
+		if ws := (&Program{Tokens: tokens}).DumpWS(); ws != src {
+			t.Errorf("%q: round trip got %q, want %q", test.Enc.symbols(), ws, src)
+		}
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	tests := []struct {
+		Spec string
+		Enc  *Encoding
+		Err  string
+	}{
+		{"stl", STLEncoding, ""},
+		{"bracket", BracketEncoding, ""},
+		{`a,b, `, &Encoding{"a", "b", " "}, ""},
+		{"a,b", nil, "ws: unrecognized encoding: a,b"},
+		{"a,ab,c", nil, `ws: encoding symbol "a" is a prefix of "ab"`},
+		{"a,,c", nil, "ws: encoding has empty symbol"},
+	}
+	for _, test := range tests {
+		enc, err := ParseEncoding(test.Spec)
+		if test.Err != "" {
+			if err == nil || err.Error() != test.Err {
+				t.Errorf("ParseEncoding(%q): got error %v, want %s", test.Spec, err, test.Err)
+			}
+			continue
+		}
+		if err != nil || *enc != *test.Enc {
+			t.Errorf("ParseEncoding(%q) = %v, %v, want %v", test.Spec, enc, err, test.Enc)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package ws
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lang is a set of instruction types accepted by a Whitespace language
+// version and extensions. The zero Lang accepts all instructions.
+type Lang uint64
+
+// Whitespace language versions. Versions 0.2 and 0.3 are those of the
+// reference Haskell interpreter and 0.4 is Harold Lee's extension.
+const (
+	WS02 = Lang(1<<Push | 1<<Dup | 1<<Swap | 1<<Drop |
+		1<<Add | 1<<Sub | 1<<Mul | 1<<Div | 1<<Mod |
+		1<<Store | 1<<Retrieve |
+		1<<Label | 1<<Call | 1<<Jmp | 1<<Jz | 1<<Jn | 1<<Ret | 1<<End |
+		1<<Printc | 1<<Printi | 1<<Readc | 1<<Readi)
+	WS03 = WS02 | 1<<Copy | 1<<Slide
+	WS04 = WS03 | 1<<Shuffle
+)
+
+// Language extensions.
+const (
+	ExtShuffle = Lang(1 << Shuffle)               // shuffle from whitespace-0.4
+	ExtTrace   = Lang(1 << Trace)                 // trace from pywhitespace
+	ExtDump    = Lang(1<<DumpStack | 1<<DumpHeap) // dumpstack and dumpheap from Burghard
+	ExtDebug   = ExtTrace | ExtDump               // all debug instructions
+	LangAll    = WS04 | ExtDebug                  // all instructions
+)
+
+var langVersions = []struct {
+	Name string
+	Lang Lang
+}{
+	{"ws0.2", WS02},
+	{"ws0.3", WS03},
+	{"ws0.4", WS04},
+}
+
+var langExts = []struct {
+	Name string
+	Lang Lang
+}{
+	{"debug", ExtDebug},
+	{"trace", ExtTrace},
+	{"dump", ExtDump},
+	{"shuffle", ExtShuffle},
+}
+
+// ParseLang parses a language of the form "version+ext+...", where the
+// version is ws0.2, ws0.3, ws0.4, or all and each extension is debug,
+// trace, dump, or shuffle.
+func ParseLang(spec string) (Lang, error) {
+	names := strings.Split(spec, "+")
+	var lang Lang
+	if names[0] == "all" {
+		lang = LangAll
+	} else {
+		for _, v := range langVersions {
+			if names[0] == v.Name {
+				lang = v.Lang
+			}
+		}
+		if lang == 0 {
+			return 0, fmt.Errorf("ws: unrecognized language version: %s", names[0])
+		}
+	}
+	for _, name := range names[1:] {
+		found := false
+		for _, ext := range langExts {
+			if name == ext.Name {
+				lang |= ext.Lang
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("ws: unrecognized language extension: %s", name)
+		}
+	}
+	return lang, nil
+}
+
+// LangNames returns the names of the language versions and extensions.
+func LangNames() (versions, exts []string) {
+	for _, v := range langVersions {
+		versions = append(versions, v.Name)
+	}
+	versions = append(versions, "all")
+	for _, ext := range langExts {
+		exts = append(exts, ext.Name)
+	}
+	return versions, exts
+}
+
+// Has returns whether the language accepts the instruction type.
+func (lang Lang) Has(typ Type) bool {
+	return lang == 0 || lang&(1<<typ) != 0
+}
+
+// require returns the lowest version or extension that accepts the
+// instruction type.
+func require(typ Type) string {
+	for _, v := range langVersions {
+		if v.Lang.Has(typ) {
+			return v.Name
+		}
+	}
+	for _, ext := range langExts[1:] {
+		if ext.Lang.Has(typ) {
+			return "+" + ext.Name
+		}
+	}
+	return "unknown"
+}
+
+// CheckLang returns an error for each token with an instruction that
+// is not in the language of the program.
+func (p *Program) CheckLang() []error {
+	var errs []error
+	for _, tok := range p.Tokens {
+		if msg, ok := p.Lang.checkType(tok.Type); !ok {
+			errs = append(errs, p.tokenError(msg, tok))
+		}
+	}
+	return errs
+}
+
+// checkType returns an error message when the language does not accept
+// the instruction type.
+func (lang Lang) checkType(typ Type) (string, bool) {
+	if lang.Has(typ) {
+		return "", true
+	}
+	return fmt.Sprintf("%s instruction is not in %s; requires %s", typ, lang, require(typ)), false
+}
+
+func (lang Lang) String() string {
+	if lang == 0 || lang == LangAll {
+		return "all"
+	}
+	var b strings.Builder
+	rest := lang
+	for i := len(langVersions) - 1; i >= 0; i-- {
+		if v := langVersions[i]; lang&v.Lang == v.Lang {
+			b.WriteString(v.Name)
+			rest &^= v.Lang
+			break
+		}
+	}
+	for _, ext := range langExts {
+		if rest&ext.Lang == ext.Lang {
+			b.WriteByte('+')
+			b.WriteString(ext.Name)
+			rest &^= ext.Lang
+		}
+	}
+	if rest != 0 {
+		fmt.Fprintf(&b, "+Lang(%#x)", uint64(rest))
+	}
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"go/token"
+	"testing"
+)
+
+func TestParseLang(t *testing.T) {
+	tests := []struct {
+		Spec string
+		Lang Lang
+		Name string
+	}{
+		{"ws0.2", WS02, "ws0.2"},
+		{"ws0.3", WS03, "ws0.3"},
+		{"ws0.4", WS04, "ws0.4"},
+		{"ws0.3+shuffle", WS04, "ws0.4"},
+		{"ws0.3+trace", WS03 | ExtTrace, "ws0.3+trace"},
+		{"ws0.2+dump+trace", WS02 | ExtDebug, "ws0.2+debug"},
+		{"all", LangAll, "all"},
+	}
+	for _, test := range tests {
+		lang, err := ParseLang(test.Spec)
+		if err != nil || lang != test.Lang || lang.String() != test.Name {
+			t.Errorf("ParseLang(%q) = %v, %v, want %v", test.Spec, lang, err, test.Name)
+		}
+	}
+	for _, spec := range []string{"ws0.5", "ws0.3+copy", ""} {
+		if _, err := ParseLang(spec); err == nil {
+			t.Errorf("ParseLang(%q): expected error", spec)
+		}
+	}
+}
+
+func TestLexTokensLang(t *testing.T) {
+	// copy 1, shuffle, end
+	src := " \t  \t\n" + " \t\t " + "\n\n\n"
+	tests := []struct {
+		Lang Lang
+		Errs []string
+	}{
+		{WS02, []string{
+			"syntax error: copy instruction is not in ws0.2; requires ws0.3 at test.ws:1:1-1:6",
+			"syntax error: shuffle instruction is not in ws0.2; requires ws0.4 at test.ws:2:1-2:4",
+		}},
+		{WS03, []string{
+			"syntax error: shuffle instruction is not in ws0.3; requires ws0.4 at test.ws:2:1-2:4",
+		}},
+		{WS04, nil},
+		{0, nil},
+	}
+	for _, test := range tests {
+		file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+		tokens, err := (&Lexer{Lang: test.Lang}).LexTokens(file, []byte(src))
+		errs, _ := err.(ErrorList)
+		if len(errs) != len(test.Errs) {
+			t.Errorf("%v: got errors %v, want %v", test.Lang, err, test.Errs)
+			continue
+		}
+		for i, err := range errs {
+			if err.Error() != test.Errs[i] {
+				t.Errorf("%v: got error %q, want %q", test.Lang, err, test.Errs[i])
+			}
+		}
+		if len(tokens) != 3-len(errs) {
+			t.Errorf("%v: got %d tokens, want %d", test.Lang, len(tokens), 3-len(errs))
+		}
+		program := &Program{Tokens: tokens, File: file, Lang: WS02}
+		if errs := program.CheckLang(); len(errs) != 2-len(test.Errs) {
+			t.Errorf("%v: got language errors %v", test.Lang, errs)
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"go/token"
 	"io"
 	"math/big"
+	"strconv"
+	"strings"
 	"unicode/utf8"
 )
 
@@ -12,57 +14,234 @@ import (
 type lexer struct {
 	file        *token.File
 	src         []byte
+	enc         *Encoding
+	strict      bool
+	lang        Lang
 	tokens      []*Token
+	errs        ErrorList
+	inst        []byte       // Whitespace characters of current instruction
+	trivia      []byte       // Trivia since the last instruction character
+	leading     string       // Leading trivia of current instruction
+	inner       []Trivia     // Inner trivia of current instruction
+	lineEnd     bool         // Last token ended with a newline
+	stray       *SyntaxError // Error for current run of characters rejected in strict mode
+	strayOffset int          // Offset of current run of rejected characters
 	offset      int
 	startOffset int
 }
 
 // SyntaxError identifies the location of a syntactic error.
-type SyntaxError struct { // TODO report instruction string
-	Err string
-	Pos token.Position
-	End token.Position // inclusive
+type SyntaxError struct {
+	Err  string
+	Inst string // Partial instruction in source encoding, without comments
+	Pos  token.Position
+	End  token.Position // inclusive
 }
 
+// ErrorList is a list of syntax errors in source order.
+type ErrorList []*SyntaxError
+
 const (
 	space = ' '
 	tab   = '\t'
 	lf    = '\n'
 )
 
-// LexTokens scans a Whitespace source file into tokens.
+// Lexer configures the lexing of Whitespace source.
+type Lexer struct {
+	Encoding *Encoding // Character encoding; nil for StdEncoding
+	Strict   bool      // Reject characters that are not instructions
+	Lang     Lang      // Accepted instructions; zero for all
+}
+
+// LexTokens scans a Whitespace source file into tokens with the default
+// configuration.
 func LexTokens(file *token.File, src []byte) ([]*Token, error) {
-	l := &lexer{file: file, src: src}
+	return (&Lexer{}).LexTokens(file, src)
+}
+
+// LexTokens scans a Whitespace source file into tokens. Characters that
+// are not instructions are kept as trivia on the tokens, so that the
+// source can be reproduced with DumpSource. In strict mode, such
+// characters are rejected, except for whitespace in a visible encoding.
+// Instructions outside of the language are rejected.
+//
+// When an instruction is invalid, the lexer skips it and resumes at the
+// next character, so that all syntax errors are reported. The error, if
+// non-nil, is an ErrorList and the tokens are those that were valid.
+func (lx *Lexer) LexTokens(file *token.File, src []byte) ([]*Token, error) {
+	l := lx.lex(file, src)
+	if len(l.errs) != 0 {
+		return l.tokens, l.errs
+	}
+	return l.tokens, nil
+}
+
+// LexProgram scans a Whitespace source file into a program, like
+// LexTokens. Trivia in a source without tokens is kept in the
+// program's trailing trivia.
+func (lx *Lexer) LexProgram(file *token.File, src []byte) (*Program, error) {
+	l := lx.lex(file, src)
+	p := &Program{Tokens: l.tokens, File: file, Lang: lx.Lang}
+	if len(l.tokens) == 0 {
+		p.Trailing = l.pending()
+	}
+	if len(l.errs) != 0 {
+		return p, l.errs
+	}
+	return p, nil
+}
+
+func (lx *Lexer) lex(file *token.File, src []byte) *lexer {
+	enc := lx.Encoding
+	if enc == nil {
+		enc = StdEncoding
+	}
+	l := &lexer{file: file, src: src, enc: enc, strict: lx.Strict, lang: lx.Lang}
 	s := rootState
-	var err error
 	for {
+		var err error
 		s, err = s.nextState(l)
 		if err == io.EOF {
-			return l.tokens, nil
+			break
 		}
 		if err != nil {
-			return nil, err
+			l.errs = append(l.errs, err.(*SyntaxError))
+			if l.offset >= len(l.src) {
+				break
+			}
+			l.startOffset = l.offset
+			l.inst = l.inst[:0]
+			l.leading, l.inner = "", nil
+			s = rootState
 		}
 	}
+	if len(l.tokens) != 0 {
+		l.tokens[len(l.tokens)-1].Trailing += l.pending()
+	}
+	return l
 }
 
+// pending returns the source text after the last token, which is the
+// leading trivia and characters of an incomplete instruction, such as
+// a final LF, and the trivia that follows.
+func (l *lexer) pending() string {
+	var b strings.Builder
+	b.WriteString(l.leading)
+	inner := l.inner
+	for i, c := range l.inst {
+		for len(inner) != 0 && inner[0].Index <= i {
+			b.WriteString(inner[0].Text)
+			inner = inner[1:]
+		}
+		b.WriteString(l.enc.Encode(string(c)))
+	}
+	for _, t := range inner {
+		b.WriteString(t.Text)
+	}
+	b.Write(l.trivia)
+	return b.String()
+}
+
+// next returns the next character, which is space, tab, or LF when
+// a symbol of the encoding is matched, and is otherwise a comment.
 func (l *lexer) next() (rune, bool) {
-	if l.offset < len(l.src) {
-		ch, size := utf8.DecodeRune(l.src[l.offset:])
-		l.offset += size
-		if ch == '\n' {
+	if l.offset >= len(l.src) {
+		return 0, true
+	}
+	src := l.src[l.offset:]
+	for i, sym := range l.enc.symbols() {
+		if len(src) >= len(sym) && string(src[:len(sym)]) == sym {
+			l.flushTrivia()
+			l.stray = nil
+			if len(l.inst) == 0 {
+				l.startOffset = l.offset
+			}
+			l.advance(len(sym))
+			ch := [3]rune{space, tab, lf}[i]
+			l.inst = append(l.inst, byte(ch))
+			return ch, false
+		}
+	}
+	ch, size := utf8.DecodeRune(src)
+	isSpace := ch == space || ch == tab || ch == lf
+	if l.strict {
+		if !(isSpace && l.enc.isVisible()) {
+			l.strayError(ch, size)
+		} else if ch == lf {
+			l.stray = nil
+		}
+	}
+	l.trivia = append(l.trivia, src[:size]...)
+	l.advance(size)
+	if isSpace {
+		ch = 0 // whitespace that is not a symbol is a comment
+	}
+	return ch, false
+}
+
+// strayError rejects a character that is not an instruction in strict
+// mode. A run of such characters on a line, separated only by
+// whitespace in a visible encoding, is reported as one error.
+func (l *lexer) strayError(ch rune, size int) {
+	pos := l.file.Position(l.file.Pos(l.offset))
+	if l.stray != nil {
+		l.stray.Err = fmt.Sprintf("unexpected characters %q", l.src[l.strayOffset:l.offset+size])
+		l.stray.End = pos
+		return
+	}
+	l.stray = &SyntaxError{
+		Err:  fmt.Sprintf("unexpected character %q", ch),
+		Inst: l.enc.Encode(string(l.inst)),
+		Pos:  pos,
+		End:  pos,
+	}
+	l.strayOffset = l.offset
+	l.errs = append(l.errs, l.stray)
+}
+
+// flushTrivia assigns the pending trivia before an instruction
+// character. Trivia within an instruction is inner trivia. Otherwise,
+// the trivia up to the end of the line of the previous token is its
+// trailing trivia and the rest is leading trivia.
+func (l *lexer) flushTrivia() {
+	if len(l.trivia) == 0 {
+		return
+	}
+	text := string(l.trivia)
+	l.trivia = l.trivia[:0]
+	if len(l.inst) != 0 {
+		l.inner = append(l.inner, Trivia{Index: len(l.inst), Text: text})
+		return
+	}
+	if len(l.tokens) != 0 && !l.lineEnd {
+		prev := l.tokens[len(l.tokens)-1]
+		i := strings.IndexByte(text, '\n')
+		if i == -1 {
+			prev.Trailing += text
+			return
+		}
+		prev.Trailing += text[:i+1]
+		text = text[i+1:]
+	}
+	l.leading += text
+}
+
+func (l *lexer) advance(n int) {
+	for _, b := range l.src[l.offset : l.offset+n] {
+		l.offset++
+		if b == '\n' {
 			l.file.AddLine(l.offset)
 		}
-		return ch, false
 	}
-	return 0, true
 }
 
 func (l *lexer) error(err string) error {
 	return &SyntaxError{
-		Err: err,
-		Pos: l.file.Position(l.file.Pos(l.startOffset)),
-		End: l.file.Position(l.file.Pos(l.offset - 1)),
+		Err:  err,
+		Inst: l.enc.Encode(string(l.inst)),
+		Pos:  l.file.Position(l.file.Pos(l.startOffset)),
+		End:  l.file.Position(l.file.Pos(l.offset - 1)),
 	}
 }
 
@@ -78,6 +257,16 @@ func (err *SyntaxError) Error() string {
 	return fmt.Sprintf("syntax error: %s at %v-%v", err.Err, err.Pos, end)
 }
 
+func (list ErrorList) Error() string {
+	switch len(list) {
+	case 0:
+		return "no errors"
+	case 1:
+		return list[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", list[0], len(list)-1)
+}
+
 type state interface {
 	nextState(*lexer) (state, error)
 }
@@ -96,7 +285,8 @@ func (t *transition) nextState(l *lexer) (state, error) {
 			if t.CanEOF {
 				return nil, io.EOF
 			}
-			return nil, l.error("incomplete instruction")
+			return nil, l.errorf("%s is an incomplete instruction; did you mean %s?",
+				strconv.Quote(l.enc.Encode(string(l.inst))), t.suggest())
 		}
 		var next state
 		switch c {
@@ -110,12 +300,37 @@ func (t *transition) nextState(l *lexer) (state, error) {
 			continue
 		}
 		if next == nil {
-			return nil, l.error("invalid instruction")
+			return nil, l.errorf("%s is not an instruction; did you mean %s?",
+				strconv.Quote(l.enc.Encode(string(l.inst))), t.suggest())
 		}
 		return next, nil
 	}
 }
 
+// suggest lists the instructions that can be completed from the
+// state.
+func (t *transition) suggest() string {
+	var names []string
+	var walk func(s state)
+	walk = func(s state) {
+		switch s := s.(type) {
+		case *transition:
+			for _, next := range []state{s.Space, s.Tab, s.LF} {
+				if next != nil {
+					walk(next)
+				}
+			}
+		case *accept:
+			names = append(names, s.Type.String())
+		}
+	}
+	walk(t)
+	if len(names) <= 2 {
+		return strings.Join(names, " or ")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + ", or " + names[len(names)-1]
+}
+
 type argType uint8
 
 const (
@@ -138,9 +353,17 @@ func (acc *accept) nextState(l *lexer) (state, error) {
 		}
 		tok.Arg = num
 	}
+	if msg, ok := l.lang.checkType(acc.Type); !ok {
+		return nil, l.error(msg)
+	}
 	tok.Pos = l.file.Pos(l.startOffset)
 	tok.End = l.file.Pos(l.offset)
+	tok.Leading, tok.Inner = l.leading, l.inner
+	tok.lexed = &lexedToken{tok.Type, tok.Arg, string(l.inst)}
 	l.startOffset = l.offset
+	l.inst = l.inst[:0]
+	l.leading, l.inner = "", nil
+	l.lineEnd = l.src[l.offset-1] == '\n'
 	l.tokens = append(l.tokens, tok)
 	return rootState, nil
 }
@@ -0,0 +1,128 @@
+package ws
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+	"testing"
+)
+
+func TestLexTokensErrors(t *testing.T) {
+	// push 1, invalid, dup, invalid, end
+	src := "   \t\n" + "x\t\n\n" + " \n " + "\n\n \n" + "\n\n\n"
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src))
+	errs, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("got error %v, want ErrorList", err)
+	}
+	wantErrs := []struct {
+		Inst, Err string
+	}{
+		{"\t\n\n", `syntax error: "\t\n\n" is not an instruction; did you mean printc, printi, readc, or readi? at test.ws:2:2-3:1`},
+		{"\n\n \n", `syntax error: "\n\n \n" is not an instruction; did you mean dumpstack or dumpheap? at test.ws:5:2-7:2`},
+	}
+	if len(errs) != len(wantErrs) {
+		t.Fatalf("got %d errors, want %d: %v", len(errs), len(wantErrs), errs)
+	}
+	for i, want := range wantErrs {
+		if errs[i].Inst != want.Inst || errs[i].Error() != want.Err {
+			t.Errorf("error %d: got %q (%q), want %q (%q)", i, errs[i].Error(), errs[i].Inst, want.Err, want.Inst)
+		}
+	}
+	want := []string{"push 1", "dup", "end"}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		if tok.String() != want[i] {
+			t.Errorf("token %d: got %s, want %s", i, tok, want[i])
+		}
+	}
+}
+
+func TestLexTokensIncomplete(t *testing.T) {
+	src := "\t "
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	_, err := LexTokens(file, []byte(src))
+	want := `syntax error: "\t " is an incomplete instruction; did you mean add, sub, mul, div, or mod? at test.ws:1:1-1:2`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestLexTokensTrivia(t *testing.T) {
+	src := "Hello, World!   \t \t \n" + // push 10 with leading zero
+		"\t\n  #printc" +
+		"\n\n\n#done" // end
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	tokens, err := LexTokens(file, []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []Token{
+		{Type: Push, Leading: "Hello,", Inner: []Trivia{{1, "World!"}}},
+		{Type: Printc, Trailing: "#printc"},
+		{Type: End, Trailing: "#done"},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		w := want[i]
+		if tok.Type != w.Type || tok.Leading != w.Leading || tok.Trailing != w.Trailing ||
+			fmt.Sprint(tok.Inner) != fmt.Sprint(w.Inner) {
+			t.Errorf("token %d: got %s %q %v %q, want %s %q %v %q", i,
+				tok.Type, tok.Leading, tok.Inner, tok.Trailing, w.Type, w.Leading, w.Inner, w.Trailing)
+		}
+	}
+	program := &Program{Tokens: tokens, File: file}
+	if got := program.DumpSource(StdEncoding); got != src {
+		t.Errorf("DumpSource() = %q, want %q", got, src)
+	}
+	tokens[0].Arg = big.NewInt(1)
+	want0 := "Hello, World!  \t\n"
+	if got := program.DumpSource(StdEncoding); got[:len(want0)] != want0 {
+		t.Errorf("DumpSource() of modified token = %q, want prefix %q", got, want0)
+	}
+
+	for _, src := range []string{
+		"\n\n\n\n",                // trailing LF
+		"  \t\n\t\n  \n\n\nfoo\n", // text and LF after end
+		"#comment\n",              // no tokens
+	} {
+		file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+		program, err := (&Lexer{}).LexProgram(file, []byte(src))
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", src, err)
+			continue
+		}
+		if got := program.DumpSource(StdEncoding); got != src {
+			t.Errorf("DumpSource() = %q, want %q", got, src)
+		}
+	}
+}
+
+func TestLexTokensStrict(t *testing.T) {
+	src := "   \t\n#\n\n\n"
+	file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+	_, err := (&Lexer{Strict: true}).LexTokens(file, []byte(src))
+	want := `syntax error: unexpected character '#' at test.ws:2:1-2:1`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	src = "SSSTL  # push 1\nLLL\n"
+	file = token.NewFileSet().AddFile("test.ws", -1, len(src))
+	_, err = (&Lexer{Encoding: STLEncoding, Strict: true}).LexTokens(file, []byte(src))
+	want = `syntax error: unexpected characters "# push 1" at test.ws:1:8-1:15`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+	src = "SSSTL # push 1\nTLSS # printc\nLLL\n"
+	file = token.NewFileSet().AddFile("test.ws", -1, len(src))
+	_, err = (&Lexer{Encoding: STLEncoding, Strict: true}).LexTokens(file, []byte(src))
+	want = `syntax error: unexpected characters "# push 1" at test.ws:1:7-1:14 (and 1 more errors)`
+	if err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
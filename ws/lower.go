@@ -3,6 +3,7 @@ package ws
 import (
 	"fmt"
 	"go/token"
+	"strings"
 
 	"github.com/andrewarchi/nebula/internal/bigint"
 	"github.com/andrewarchi/nebula/ir"
@@ -15,23 +16,39 @@ type irBuilder struct {
 	tokenBlocks [][]*Token
 	stack       *ir.Stack
 	labelBlocks *bigint.Map // map[*big.Int]*ir.BasicBlock
-	file        *token.File
+	program     *Program
 	errs        []error
 }
 
 // TokenError is an error emitted while lowering to SSA form.
 type TokenError struct {
-	Token *Token
-	Pos   token.Position
-	Err   string
+	Token    *Token
+	Pos      token.Position
+	Expanded []token.Position // Macro use sites, innermost first
+	Err      string
 }
 
 func (err *TokenError) Error() string {
-	return fmt.Sprintf("%s: %v at %v", err.Err, err.Token, err.Pos)
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %v at %v", err.Err, err.Token, err.Pos)
+	for _, pos := range err.Expanded {
+		fmt.Fprintf(&b, " (expanded from %v)", pos)
+	}
+	return b.String()
 }
 
 func (ib *irBuilder) err(err string, tok *Token) {
-	ib.errs = append(ib.errs, &TokenError{tok, ib.file.Position(tok.Pos), err})
+	ib.errs = append(ib.errs, ib.program.tokenError(err, tok))
+}
+
+// tokenError constructs a TokenError positioned at the token and the
+// macro uses that it was expanded from.
+func (p *Program) tokenError(err string, tok *Token) *TokenError {
+	var expanded []token.Position
+	for exp := tok.Expansion; exp != nil; exp = exp.Parent {
+		expanded = append(expanded, p.Position(exp.Pos))
+	}
+	return &TokenError{tok, p.Position(tok.Pos), expanded, err}
 }
 
 func (ib *irBuilder) Errs() []error {
@@ -44,18 +61,20 @@ func (p *Program) LowerIR() (*ir.Program, []error) {
 		Builder:     ir.NewBuilder(p.File),
 		tokens:      p.Tokens,
 		labelBlocks: bigint.NewMap(),
-		file:        p.File,
+		program:     p,
 	}
 	ib.stack = &ir.Stack{
 		HandleAccess: ib.handleAccess,
 		HandleLoad:   ib.handleLoad,
 	}
+	ib.errs = append(ib.errs, p.CheckLang()...)
 	labelUses := ib.collectLabels()
 	ib.splitTokens(labelUses)
 	for i, tokens := range ib.tokenBlocks {
 		ib.convertBlock(ib.Block(i), tokens)
 	}
 	ssa, err := ib.Program()
+	ssa.FileSet = p.FileSet
 	if err != nil {
 		ib.errs = append(ib.errs, err)
 	}
@@ -98,12 +117,12 @@ func (ib *irBuilder) splitTokens(labelUses *bigint.Map) {
 	lo := 0
 	for i := 0; i < len(ib.tokens); i++ {
 		tok := ib.tokens[i]
-		if !tok.Type.IsControl() {
+		if !tok.Type.IsControl() && tok.Type != Shuffle && tok.Type != Trace && tok.Type != DumpStack {
 			start = false
 			continue
 		}
 		if tok.Type == Label {
-			if start || !labelUses.Has(tok.Arg) {
+			if start || !labelUses.Has(tok.Arg) && tok.Meta == nil {
 				continue
 			}
 			i--
@@ -146,8 +165,12 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 	ib.SetCurrentBlock(block)
 	ib.stack.Clear()
 	start := true
+	var stackTok *Token
 	for _, tok := range tokens {
 		pos := tok.Pos
+		for _, assert := range tok.Asserts {
+			ib.assert(block, assert)
+		}
 		switch tok.Type {
 		case Push:
 			ib.stack.Push(ir.NewIntConst(tok.Arg, pos))
@@ -165,10 +188,11 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 			if n, ok := ib.uintArg(tok); ok {
 				ib.stack.Slide(n, pos)
 			}
-		case Shuffle:
-			// Shuffle invalidates SSA value references and in most cases, the
-			// stack would need to be preserved.
-			ib.err("shuffle instruction not supported", tok)
+		case Shuffle, Trace, DumpStack:
+			// Shuffle, trace, and dumpstack operate on the entire runtime
+			// stack, so they end the block and are emitted once the stack
+			// is stored.
+			stackTok = tok
 
 		case Add:
 			lhs, rhs := ib.stack.Pop2(pos)
@@ -195,6 +219,9 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 		case Label:
 			if start {
 				block.Labels = append(block.Labels, ir.Label{ID: tok.Arg, Name: tok.ArgString})
+				if tok.Meta != nil {
+					ib.annotate(block, tok)
+				}
 			}
 		case Call:
 			ib.CreateCallTerm(ib.callee(tok), block.Next, pos)
@@ -220,14 +247,8 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 		case Readi:
 			ib.CreateStoreHeapStmt(ib.stack.Pop(pos), ib.CreateReadExpr(ir.ReadInt, pos), pos)
 
-		// Aggressive optimizations may discard information needed to dump
-		// the stack or heap.
-		case Trace:
-			ib.err("trace instruction not supported", tok)
-		case DumpStack:
-			ib.err("dumpstack instruction not supported", tok)
 		case DumpHeap:
-			ib.err("dumpheap instruction not supported", tok)
+			ib.CreateDebugStmt(ir.DumpHeap, pos)
 
 		default:
 			panic(fmt.Sprintf("unrecognized token type: %v", tok.Type))
@@ -242,6 +263,16 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 	for i, val := range ib.stack.Values() {
 		ib.CreateStoreStackStmt(ib.stack.Len()-uint(i), val, val.Pos())
 	}
+	if stackTok != nil {
+		switch stackTok.Type {
+		case Shuffle:
+			ib.CreateShuffleStackStmt(stackTok.Pos)
+		case Trace:
+			ib.CreateDebugStmt(ir.Trace, stackTok.Pos)
+		case DumpStack:
+			ib.CreateDebugStmt(ir.DumpStack, stackTok.Pos)
+		}
+	}
 	if block.Terminator == nil {
 		if block.Next != nil {
 			ib.CreateJmpTerm(ir.Fallthrough, block.Next, token.NoPos) // TODO source position
@@ -251,6 +282,37 @@ func (ib *irBuilder) convertBlock(block *ir.BasicBlock, tokens []*Token) {
 	}
 }
 
+// annotate adds the label annotations of a token to a block.
+func (ib *irBuilder) annotate(block *ir.BasicBlock, tok *Token) {
+	meta := block.Annotate()
+	if tok.Meta.Stack != nil {
+		if meta.Stack != nil && *meta.Stack != *tok.Meta.Stack {
+			ib.err("stack signature conflicts with other label", tok)
+		}
+		meta.Stack = tok.Meta.Stack
+	}
+	meta.Pure = meta.Pure || tok.Meta.Pure
+	meta.NoReturn = meta.NoReturn || tok.Meta.NoReturn
+	if !meta.Pos.IsValid() {
+		meta.Pos = tok.Meta.Pos
+	}
+}
+
+// assert adds an assertion to a block with the operands at the current
+// stack state.
+func (ib *irBuilder) assert(block *ir.BasicBlock, assert *Assertion) {
+	var args [2]ir.Value
+	for i, arg := range assert.Args {
+		if arg.Int != nil {
+			args[i] = ir.NewIntConst(arg.Int, assert.Pos)
+		} else {
+			args[i] = ib.stack.At(arg.Slot, assert.Pos)
+		}
+	}
+	meta := block.Annotate()
+	meta.Asserts = append(meta.Asserts, ir.NewAssertion(assert.Op, args[0], args[1], assert.Pos))
+}
+
 func (ib *irBuilder) uintArg(tok *Token) (uint, bool) {
 	n, ok := bigint.ToUint(tok.Arg)
 	if tok.Arg.Sign() == -1 {
@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"go/token"
+	"math/big"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ir"
+)
+
+func TestLowerShuffle(t *testing.T) {
+	tokens := []*Token{
+		{Type: Push, Arg: big.NewInt(1), Pos: 1},
+		{Type: Push, Arg: big.NewInt(2), Pos: 2},
+		{Type: Shuffle, Pos: 3},
+		{Type: Printi, Pos: 4},
+		{Type: End, Pos: 5},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 6)
+	p, errs := (&Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    offsetstack 2
+    storestack 2 1
+    storestack 1 2
+    shufflestack
+    fallthrough block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    accessstack 1
+    %0 = loadstack 1
+    printint %0
+    flush
+    offsetstack -1
+    exit
+`
+	if got := ir.NewFormatter().FormatProgram(p); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestLowerDebug(t *testing.T) {
+	tokens := []*Token{
+		{Type: Push, Arg: big.NewInt(1), Pos: 1},
+		{Type: Push, Arg: big.NewInt(2), Pos: 2},
+		{Type: Store, Pos: 3},
+		{Type: Trace, Pos: 4},
+		{Type: DumpHeap, Pos: 5},
+		{Type: Push, Arg: big.NewInt(3), Pos: 6},
+		{Type: DumpStack, Pos: 7},
+		{Type: End, Pos: 8},
+	}
+	file := token.NewFileSet().AddFile("test", -1, 9)
+	p, errs := (&Program{Tokens: tokens, File: file}).LowerIR()
+	if len(errs) != 0 {
+		t.Fatalf("unexpected error: %v", errs)
+	}
+	want := `block_0:
+    ; entries: <entry>
+    ; callers: <entry>
+    storeheap 1 2
+    trace
+    fallthrough block_1
+
+block_1:
+    ; entries: block_0
+    ; callers: <entry>
+    dumpheap
+    offsetstack 1
+    storestack 1 3
+    dumpstack
+    fallthrough block_2
+
+block_2:
+    ; entries: block_1
+    ; callers: <entry>
+    exit
+`
+	if got := ir.NewFormatter().FormatProgram(p); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -2,38 +2,26 @@ package ws
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"go/token"
 	"io"
 	"math/big"
+	"strconv"
+	"strings"
 
 	"github.com/andrewarchi/nebula/internal/bigint"
 )
 
 // ParseLabelMap reads a label source map and parses it into mappings
-// from label name to integer value.
+// from label name to integer value. Both source maps written by
+// WriteSourceMap and label maps of "label:name" lines are accepted.
 func ParseLabelMap(r io.Reader) (*bigint.Map, error) {
-	br := bufio.NewReader(r)
-	labels := bigint.NewMap() // map[*big.Int]string
-	for {
-		labelText, err := br.ReadString(':')
-		if err == io.EOF {
-			return labels, nil
-		} else if err != nil {
-			return nil, err
-		}
-		labelText = labelText[:len(labelText)-1]
-		label, ok := new(big.Int).SetString(labelText, 10)
-		if !ok {
-			return nil, fmt.Errorf("invalid source map label: %v", labelText)
-		}
-		name, err := br.ReadString('\n')
-		if err != nil {
-			return nil, err
-		}
-		if labels.Put(label, name[:len(name)-1]) {
-			return nil, fmt.Errorf("duplicate source map label: %v", labelText)
-		}
+	m, err := ParseSourceMap(r)
+	if err != nil {
+		return nil, err
 	}
+	return m.Labels, nil
 }
 
 // ApplyLabelMap adds label names from mapping to tokens.
@@ -49,3 +37,249 @@ func ApplyLabelMap(tokens []*Token, labelNames *bigint.Map /* map[*big.Int]strin
 		}
 	}
 }
+
+// SourceMap links the tokens of a Whitespace file to their positions
+// in the assembly source that it was generated from.
+type SourceMap struct {
+	Tokens []MappedToken
+	Labels *bigint.Map // map[*big.Int]string
+}
+
+// MappedToken is the source position of the token at an offset in
+// Whitespace source.
+type MappedToken struct {
+	Offset    int               // Offset of token in Whitespace source
+	Pos       token.Position    // Position in assembly source
+	Expansion []MappedExpansion // Macro uses producing token, innermost first
+}
+
+// MappedExpansion is a macro use in assembly source.
+type MappedExpansion struct {
+	Name string
+	Pos  token.Position
+}
+
+// SourceMap constructs a source map of the program with offsets of the
+// tokens as formatted by DumpWSEncoding.
+func (p *Program) SourceMap(enc *Encoding) *SourceMap {
+	m := &SourceMap{Labels: bigint.NewMap()}
+	visible := enc.isVisible()
+	offset := 0
+	for _, tok := range p.Tokens {
+		mt := MappedToken{Offset: offset, Pos: p.Position(tok.Pos)}
+		for exp := tok.Expansion; exp != nil; exp = exp.Parent {
+			mt.Expansion = append(mt.Expansion, MappedExpansion{exp.Name, p.Position(exp.Pos)})
+		}
+		m.Tokens = append(m.Tokens, mt)
+		if tok.Type == Label && tok.ArgString != "" {
+			m.Labels.Put(tok.Arg, tok.ArgString)
+		}
+		offset += len(enc.Encode(tok.StringWS()))
+		if visible {
+			offset++
+		}
+	}
+	return m
+}
+
+// WriteSourceMap writes a source map with a line for each label name,
+// mapped token and macro expansion. Expansion lines follow the token
+// that they produced.
+//
+//	label 2 start.loop
+//	token 12 "prog.wsa" 3 5
+//	expand dup2 "prog.wsa" 20 1
+func WriteSourceMap(w io.Writer, m *SourceMap) error {
+	bw := bufio.NewWriter(w)
+	if m.Labels != nil {
+		for _, e := range m.Labels.Pairs() {
+			fmt.Fprintf(bw, "label %s %s\n", e.K, e.V)
+		}
+	}
+	for _, tok := range m.Tokens {
+		if !tok.Pos.IsValid() {
+			continue
+		}
+		fmt.Fprintf(bw, "token %d %s\n", tok.Offset, formatMapPos(tok.Pos))
+		for _, exp := range tok.Expansion {
+			fmt.Fprintf(bw, "expand %s %s\n", exp.Name, formatMapPos(exp.Pos))
+		}
+	}
+	return bw.Flush()
+}
+
+func formatMapPos(pos token.Position) string {
+	return fmt.Sprintf("%q %d %d", pos.Filename, pos.Line, pos.Column)
+}
+
+// ParseSourceMap reads a source map in the format written by
+// WriteSourceMap. Label maps of "label:name" lines are also accepted.
+func ParseSourceMap(r io.Reader) (*SourceMap, error) {
+	br := bufio.NewReader(r)
+	m := &SourceMap{Labels: bigint.NewMap()}
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			return m, nil
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if err := m.parseLine(line); err != nil {
+			return nil, fmt.Errorf("source map line %d: %v", lineNum, err)
+		}
+	}
+}
+
+func (m *SourceMap) parseLine(line string) error {
+	kind, rest := line, ""
+	if i := strings.IndexByte(line, ' '); i != -1 {
+		kind, rest = line[:i], line[i+1:]
+	}
+	switch kind {
+	case "label":
+		i := strings.IndexByte(rest, ' ')
+		if i == -1 {
+			return errors.New("expected label name")
+		}
+		return m.putLabel(rest[:i], rest[i+1:])
+	case "token":
+		i := strings.IndexByte(rest, ' ')
+		if i == -1 {
+			return errors.New("expected position")
+		}
+		offset, err := strconv.Atoi(rest[:i])
+		if err != nil || offset < 0 {
+			return fmt.Errorf("invalid offset: %s", rest[:i])
+		}
+		if n := len(m.Tokens); n != 0 && m.Tokens[n-1].Offset >= offset {
+			return fmt.Errorf("offset out of order: %d", offset)
+		}
+		pos, err := parseMapPos(rest[i+1:])
+		if err != nil {
+			return err
+		}
+		m.Tokens = append(m.Tokens, MappedToken{Offset: offset, Pos: pos})
+	case "expand":
+		if len(m.Tokens) == 0 {
+			return errors.New("expansion must follow a token")
+		}
+		i := strings.IndexByte(rest, ' ')
+		if i == -1 {
+			return errors.New("expected position")
+		}
+		pos, err := parseMapPos(rest[i+1:])
+		if err != nil {
+			return err
+		}
+		tok := &m.Tokens[len(m.Tokens)-1]
+		tok.Expansion = append(tok.Expansion, MappedExpansion{rest[:i], pos})
+	case "":
+	default:
+		// Label map entry of the form "label:name"
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			return m.putLabel(line[:i], line[i+1:])
+		}
+		return fmt.Errorf("unknown entry: %s", kind)
+	}
+	return nil
+}
+
+func (m *SourceMap) putLabel(labelText, name string) error {
+	label, ok := new(big.Int).SetString(labelText, 10)
+	if !ok {
+		return fmt.Errorf("invalid source map label: %v", labelText)
+	}
+	if m.Labels.Put(label, name) {
+		return fmt.Errorf("duplicate source map label: %v", labelText)
+	}
+	return nil
+}
+
+func parseMapPos(s string) (token.Position, error) {
+	i := strings.LastIndexByte(s, ' ')
+	if i == -1 {
+		return token.Position{}, fmt.Errorf("invalid position: %s", s)
+	}
+	j := strings.LastIndexByte(s[:i], ' ')
+	if j == -1 {
+		return token.Position{}, fmt.Errorf("invalid position: %s", s)
+	}
+	filename, err := strconv.Unquote(s[:j])
+	if err != nil {
+		return token.Position{}, fmt.Errorf("invalid filename: %s", s)
+	}
+	line, err1 := strconv.Atoi(s[j+1 : i])
+	col, err2 := strconv.Atoi(s[i+1:])
+	if err1 != nil || err2 != nil || line <= 0 || col <= 0 {
+		return token.Position{}, fmt.Errorf("invalid position: %s", s)
+	}
+	return token.Position{Filename: filename, Line: line, Column: col}, nil
+}
+
+// ApplySourceMap adds label names from the source map to tokens and
+// repositions mapped tokens and their macro expansions in the assembly
+// source. The positions are allocated in the program's file set, so
+// that they resolve to the original filename, line, and column.
+func (p *Program) ApplySourceMap(m *SourceMap) error {
+	if p.FileSet == nil {
+		return errors.New("ws: source map requires a file set")
+	}
+	if m.Labels != nil {
+		ApplyLabelMap(p.Tokens, m.Labels)
+	}
+	byOffset := make(map[int]*MappedToken, len(m.Tokens))
+	var positions []token.Position
+	for i := range m.Tokens {
+		tok := &m.Tokens[i]
+		byOffset[tok.Offset] = tok
+		positions = append(positions, tok.Pos)
+		for _, exp := range tok.Expansion {
+			positions = append(positions, exp.Pos)
+		}
+	}
+	mapped := allocPositions(p.FileSet, positions)
+	for _, tok := range p.Tokens {
+		mt, ok := byOffset[p.File.Offset(tok.Pos)]
+		if !ok {
+			continue
+		}
+		tok.Pos = mapped[mt.Pos]
+		tok.End = token.NoPos
+		tok.Expansion = nil
+		for i := len(mt.Expansion) - 1; i >= 0; i-- {
+			exp := mt.Expansion[i]
+			tok.Expansion = &Expansion{Name: exp.Name, Pos: mapped[exp.Pos], Parent: tok.Expansion}
+		}
+	}
+	return nil
+}
+
+// allocPositions adds a file to fset for each filename in positions and
+// allocates a position in it for each distinct position, such that it
+// resolves to the original line and column.
+func allocPositions(fset *token.FileSet, positions []token.Position) map[token.Position]token.Pos {
+	var filenames []string
+	files := make(map[string][]token.Position)
+	seen := make(map[token.Position]bool)
+	for _, pos := range positions {
+		if seen[pos] {
+			continue
+		}
+		seen[pos] = true
+		if _, ok := files[pos.Filename]; !ok {
+			filenames = append(filenames, pos.Filename)
+		}
+		files[pos.Filename] = append(files[pos.Filename], pos)
+	}
+	mapped := make(map[token.Position]token.Pos, len(seen))
+	for _, filename := range filenames {
+		filePositions := files[filename]
+		file := fset.AddFile(filename, -1, len(filePositions))
+		for i, pos := range filePositions {
+			file.AddLineColumnInfo(i, filename, pos.Line, pos.Column)
+			mapped[pos] = file.Pos(i)
+		}
+	}
+	return mapped
+}
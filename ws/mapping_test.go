@@ -0,0 +1,127 @@
+package ws
+
+import (
+	"go/token"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestLabelMap(t *testing.T) {
+	tokens := []*Token{
+		{Type: Label, Arg: big.NewInt(0), ArgString: "start"},
+		{Type: Jmp, Arg: big.NewInt(2), ArgString: "start.loop"},
+		{Type: Label, Arg: big.NewInt(1)},
+		{Type: Label, Arg: big.NewInt(2), ArgString: "start.loop"},
+		{Type: Call, Arg: big.NewInt(3), ArgString: ".exit"},
+		{Type: Label, Arg: big.NewInt(3), ArgString: ".exit"},
+	}
+	var b strings.Builder
+	if err := WriteSourceMap(&b, (&Program{Tokens: tokens}).SourceMap(StdEncoding)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := "label 0 start\nlabel 2 start.loop\nlabel 3 .exit\n"
+	if b.String() != want {
+		t.Errorf("got map %q, want %q", b.String(), want)
+	}
+
+	for _, src := range []string{b.String(), "0:start\n2:start.loop\n3:.exit\n"} {
+		labels, err := ParseLabelMap(strings.NewReader(src))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(labels.Pairs()) != 3 {
+			t.Errorf("got %d labels from %q, want 3", len(labels.Pairs()), src)
+		}
+		unnamed := make([]*Token, len(tokens))
+		for i, tok := range tokens {
+			unnamed[i] = &Token{Type: tok.Type, Arg: tok.Arg}
+		}
+		ApplyLabelMap(unnamed, labels)
+		for i, tok := range unnamed {
+			if tok.ArgString != tokens[i].ArgString {
+				t.Errorf("token %d: got name %q, want %q", i, tok.ArgString, tokens[i].ArgString)
+			}
+		}
+	}
+}
+
+func TestSourceMap(t *testing.T) {
+	fset := token.NewFileSet()
+	wsaFile := fset.AddFile("prog.wsa", -1, 100)
+	wsaFile.SetLines([]int{0, 10, 20, 30})
+	exp := &Expansion{Name: "twice", Pos: wsaFile.Pos(32)}
+	asm := &Program{
+		Tokens: []*Token{
+			{Type: Label, Arg: big.NewInt(0), ArgString: "start", Pos: wsaFile.Pos(0)},
+			{Type: Push, Arg: big.NewInt(3), Pos: wsaFile.Pos(14), Expansion: exp},
+			{Type: Dup, Pos: wsaFile.Pos(24), Expansion: exp},
+			{Type: End, Pos: wsaFile.Pos(34)},
+		},
+		File:    wsaFile,
+		FileSet: fset,
+	}
+	var b strings.Builder
+	if err := WriteSourceMap(&b, asm.SourceMap(StdEncoding)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `label 0 start
+token 0 "prog.wsa" 1 1
+token 4 "prog.wsa" 2 5
+expand twice "prog.wsa" 4 3
+token 10 "prog.wsa" 3 5
+expand twice "prog.wsa" 4 3
+token 13 "prog.wsa" 4 5
+`
+	if b.String() != want {
+		t.Errorf("got map:\n%s\nwant:\n%s", b.String(), want)
+	}
+
+	m, err := ParseSourceMap(strings.NewReader(b.String()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	src := []byte(asm.DumpWS())
+	fset = token.NewFileSet()
+	file := fset.AddFile("prog.ws", -1, len(src))
+	tokens, err := LexTokens(file, src)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	p := &Program{Tokens: tokens, File: file, FileSet: fset}
+	if err := p.ApplySourceMap(m); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := p.Tokens[0].ArgString; got != "start" {
+		t.Errorf("got label name %q, want %q", got, "start")
+	}
+	for i, tok := range p.Tokens {
+		got, want := p.Position(tok.Pos).String(), asm.Position(asm.Tokens[i].Pos).String()
+		if got != want {
+			t.Errorf("token %d: got position %s, want %s", i, got, want)
+		}
+	}
+	if exp := p.Tokens[1].Expansion; exp == nil || exp.Name != "twice" || p.Position(exp.Pos).String() != "prog.wsa:4:3" {
+		t.Errorf("got expansion %+v, want twice at prog.wsa:4:3", exp)
+	}
+}
+
+func TestParseSourceMapErrors(t *testing.T) {
+	tests := []struct {
+		src, err string
+	}{
+		{"token 4 \"a.wsa\" 1 1\ntoken 2 \"a.wsa\" 1 2\n", "source map line 2: offset out of order: 2"},
+		{"expand m \"a.wsa\" 1 1\n", "source map line 1: expansion must follow a token"},
+		{"token 0 a.wsa 1 1\n", "source map line 1: invalid filename: a.wsa 1 1"},
+		{"token 0 \"a.wsa\" 0 1\n", "source map line 1: invalid position: \"a.wsa\" 0 1"},
+		{"label x start\n", "source map line 1: invalid source map label: x"},
+		{"0:start\n0:end\n", "source map line 2: duplicate source map label: 0"},
+		{"bogus\n", "source map line 1: unknown entry: bogus"},
+	}
+	for _, tt := range tests {
+		_, err := ParseSourceMap(strings.NewReader(tt.src))
+		if err == nil || err.Error() != tt.err {
+			t.Errorf("ParseSourceMap(%q): got error %v, want %q", tt.src, err, tt.err)
+		}
+	}
+}
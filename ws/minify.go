@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"math/big"
+	"sort"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+)
+
+// Minify rewrites the program for its shortest Whitespace encoding.
+// Labels are renumbered by use frequency, so that the most used labels
+// have the shortest encodings, and unused labels are dropped. A push
+// of the constant that was just pushed becomes dup, as does copy 0,
+// and slide 0 is dropped. Label names are preserved.
+func (p *Program) Minify() {
+	type labelUse struct {
+		label *big.Int
+		count int
+		first int
+	}
+	uses := bigint.NewMap()    // map[*big.Int]*labelUse
+	defined := bigint.NewMap() // map[*big.Int]nil
+	for i, tok := range p.Tokens {
+		switch tok.Type {
+		case Label:
+			defined.Put(tok.Arg, nil)
+		case Call, Jmp, Jz, Jn:
+			u, _ := uses.GetOrPut(tok.Arg, &labelUse{tok.Arg, 0, i})
+			u.(*labelUse).count++
+		}
+	}
+	var labels []*labelUse
+	for _, pair := range uses.Pairs() {
+		u := pair.V.(*labelUse)
+		if defined.Has(u.label) {
+			u.count++ // definition
+		}
+		labels = append(labels, u)
+	}
+	sort.SliceStable(labels, func(i, j int) bool {
+		if labels[i].count != labels[j].count {
+			return labels[i].count > labels[j].count
+		}
+		return labels[i].first < labels[j].first
+	})
+	ids := bigint.NewMap() // map[*big.Int]*big.Int
+	for i, u := range labels {
+		ids.Put(u.label, big.NewInt(int64(i)))
+	}
+
+	tokens := p.Tokens[:0]
+	var pushed *big.Int // Constant on top of stack from preceding push
+	for _, tok := range p.Tokens {
+		switch tok.Type {
+		case Label, Call, Jmp, Jz, Jn:
+			id, ok := ids.Get(tok.Arg)
+			if !ok {
+				continue // unused label
+			}
+			tok.Arg = new(big.Int).Set(id.(*big.Int))
+		case Push:
+			if pushed != nil && pushed.Cmp(tok.Arg) == 0 {
+				tok.Type, tok.Arg = Dup, nil
+			}
+		case Copy:
+			if tok.Arg.Sign() == 0 {
+				tok.Type, tok.Arg = Dup, nil
+			}
+		case Slide:
+			if tok.Arg.Sign() == 0 {
+				continue
+			}
+		}
+		switch tok.Type {
+		case Push:
+			pushed = tok.Arg
+		case Dup: // top is unchanged
+		default:
+			pushed = nil
+		}
+		tokens = append(tokens, tok)
+	}
+	p.Tokens = tokens
+}
@@ -0,0 +1,50 @@
+package ws
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMinify(t *testing.T) {
+	p := &Program{Tokens: []*Token{
+		{Type: Label, Arg: big.NewInt(537668), ArgString: "start"},
+		{Type: Push, Arg: big.NewInt(7)},
+		{Type: Push, Arg: big.NewInt(7)},
+		{Type: Push, Arg: big.NewInt(7)},
+		{Type: Copy, Arg: big.NewInt(0)},
+		{Type: Slide, Arg: big.NewInt(0)},
+		{Type: Call, Arg: big.NewInt(99), ArgString: "loop"},
+		{Type: Label, Arg: big.NewInt(12)},
+		{Type: Push, Arg: big.NewInt(7)},
+		{Type: Jmp, Arg: big.NewInt(537668), ArgString: "start"},
+		{Type: Label, Arg: big.NewInt(99), ArgString: "loop"},
+		{Type: Jz, Arg: big.NewInt(99), ArgString: "loop"},
+		{Type: Jn, Arg: big.NewInt(99), ArgString: "loop"},
+		{Type: Ret},
+	}}
+	p.Minify()
+	want := `start:
+    push 7
+    dup
+    dup
+    dup
+    call loop
+    push 7
+    jmp start
+loop:
+    jz loop
+    jn loop
+    ret
+`
+	if got := p.Dump("    "); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+	ids := map[string]int64{"start": 1, "loop": 0}
+	for _, tok := range p.Tokens {
+		if tok.Type.IsControl() && tok.Arg != nil {
+			if id := ids[tok.ArgString]; tok.Arg.Int64() != id {
+				t.Errorf("%v: got label %v, want %d", tok, tok.Arg, id)
+			}
+		}
+	}
+}
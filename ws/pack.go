@@ -1,111 +1,153 @@
 package ws
 
-type packer struct {
-	text   []byte
-	bits   []byte
-	curr   byte
-	offset uint
-	bit    uint
-}
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+)
 
 // Pack bit packs a Whitespace source.
 func Pack(src []byte) []byte {
-	p := packer{src, nil, 0, 0, 7}
-	appendOne := false
-	for {
-		c, eof := p.readByte()
-		if eof {
-			if appendOne { // marker bit follows trailing zeros
-				p.writeBit(1)
-			}
-			p.flushBits()
-			return p.bits
-		}
+	var b bytes.Buffer
+	e := NewEncoder(&b)
+	e.Write(src)
+	e.Close()
+	return b.Bytes()
+}
+
+// Unpack expands a bit packed source.
+func Unpack(bits []byte) []byte {
+	text, _ := ioutil.ReadAll(NewDecoder(bytes.NewReader(bits)))
+	return text
+}
+
+// Encoder bit packs Whitespace source written to it. Space is packed
+// as 0, tab as 10, and LF as 11, most significant bit first, and other
+// characters are ignored. When the source ends with trailing zero bits,
+// a marker bit is appended.
+type Encoder struct {
+	w         *bufio.Writer
+	curr      byte
+	bit       uint
+	appendOne bool
+}
+
+// NewEncoder constructs an Encoder that writes bit packed source to w.
+// Close must be called to write the final byte.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w), bit: 7}
+}
+
+// Write packs the Whitespace characters in p.
+func (e *Encoder) Write(p []byte) (int, error) {
+	for _, c := range p {
 		switch c {
 		case space:
-			p.writeBit(0)
-			appendOne = true
+			e.writeBit(0)
+			e.appendOne = true
 		case tab:
-			p.writeBit(1)
-			p.writeBit(0)
-			appendOne = true
+			e.writeBit(1)
+			e.writeBit(0)
+			e.appendOne = true
 		case lf:
-			p.writeBit(1)
-			p.writeBit(1)
-			appendOne = false
+			e.writeBit(1)
+			e.writeBit(1)
+			e.appendOne = false
 		}
 	}
+	return len(p), nil
 }
 
-// Unpack expands a bit packed source.
-func Unpack(bits []byte) []byte {
-	p := packer{nil, bits, 0, 0, 7}
-	for {
-		b, eof := p.readBit()
-		if eof {
-			return p.text
-		}
-		if !b {
-			p.writeByte(space)
-		} else {
-			b, eof = p.readBit()
-			if eof { // marker bit
-				return p.text
-			}
-			if b {
-				p.writeByte(lf)
-			} else {
-				p.writeByte(tab)
-			}
-		}
+// Close writes the marker bit, if needed, and the final partial byte
+// and flushes the underlying writer. It does not close the underlying
+// writer.
+func (e *Encoder) Close() error {
+	if e.appendOne { // marker bit follows trailing zeros
+		e.writeBit(1)
+		e.appendOne = false
+	}
+	if e.bit != 7 && e.curr != 0 {
+		e.w.WriteByte(e.curr)
 	}
+	e.curr, e.bit = 0, 7
+	return e.w.Flush()
 }
 
-func (p *packer) readByte() (byte, bool) {
-	if p.offset >= uint(len(p.text)) {
-		return 0, true
+func (e *Encoder) writeBit(b byte) {
+	e.curr |= b << e.bit
+	if e.bit == 0 {
+		e.bit = 7
+		e.w.WriteByte(e.curr)
+		e.curr = 0
+	} else {
+		e.bit--
 	}
-	c := p.text[p.offset]
-	p.offset++
-	return c, false
 }
 
-func (p *packer) writeByte(c byte) {
-	p.text = append(p.text, c)
+// Decoder expands a bit packed source read from an underlying reader.
+type Decoder struct {
+	r    *bufio.Reader
+	curr byte
+	n    uint // Number of unread bits in curr
+	last bool // Whether curr is the final byte
+	err  error
 }
 
-func (p *packer) readBit() (bool, bool) {
-	if p.offset >= uint(len(p.bits)) {
-		return false, true
-	}
-	c := p.bits[p.offset]
-	// Ignore trailing zeros on last byte
-	if p.offset+1 == uint(len(p.bits)) && c<<(7-p.bit) == 0 {
-		return false, true
-	}
-	b := c&(1<<p.bit) != 0
-	if p.bit == 0 {
-		p.bit = 7
-		p.offset++
-	} else {
-		p.bit--
-	}
-	return b, false
+// NewDecoder constructs a Decoder that reads bit packed source from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
 }
 
-func (p *packer) writeBit(b byte) {
-	p.curr |= b << p.bit
-	if p.bit == 0 {
-		p.bit = 7
-		p.bits = append(p.bits, p.curr)
-		p.curr = 0
-	} else {
-		p.bit--
+// Read reads unpacked Whitespace source into p.
+func (d *Decoder) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && d.err == nil {
+		b, err := d.readBit()
+		if err != nil {
+			d.err = err
+			break
+		}
+		if b == 0 {
+			p[n] = space
+		} else {
+			b, err = d.readBit()
+			if err != nil { // marker bit
+				d.err = err
+				break
+			}
+			if b == 1 {
+				p[n] = lf
+			} else {
+				p[n] = tab
+			}
+		}
+		n++
 	}
+	if n == 0 && d.err != nil {
+		return 0, d.err
+	}
+	return n, nil
 }
 
-func (p *packer) flushBits() {
-	if p.bit != 7 && p.curr != 0 {
-		p.bits = append(p.bits, p.curr)
+func (d *Decoder) readBit() (byte, error) {
+	if d.n == 0 {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if _, err := d.r.Peek(1); err == io.EOF {
+			d.last = true
+		} else if err != nil {
+			return 0, err
+		}
+		d.curr, d.n = c, 8
+	}
+	// Ignore trailing zeros on last byte
+	if d.last && d.curr&(1<<d.n-1) == 0 {
+		d.n = 0
+		return 0, io.EOF
 	}
+	d.n--
+	return d.curr >> d.n & 1, nil
 }
@@ -1,6 +1,11 @@
 package ws
 
-import "testing"
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
 
 var tests = []struct{ unpacked, packed []byte }{
 	{ // no marker bit, no padding
@@ -38,3 +43,31 @@ func TestUnpack(t *testing.T) {
 		}
 	}
 }
+
+func TestEncoder(t *testing.T) {
+	for i, test := range tests {
+		var b bytes.Buffer
+		e := NewEncoder(&b)
+		for _, c := range test.unpacked { // write one character at a time
+			e.Write([]byte{c})
+		}
+		if err := e.Close(); err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if b.String() != string(test.packed) {
+			t.Errorf("test %d: got %b, want %b", i, b.Bytes(), test.packed)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	for i, test := range tests {
+		u, err := ioutil.ReadAll(iotest.OneByteReader(NewDecoder(iotest.OneByteReader(bytes.NewReader(test.packed)))))
+		if err != nil {
+			t.Fatalf("test %d: unexpected error: %v", i, err)
+		}
+		if string(u) != string(test.unpacked) {
+			t.Errorf("test %d: got %b, want %b", i, u, test.unpacked)
+		}
+	}
+}
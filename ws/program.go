@@ -1,7 +1,6 @@
 package ws
 
 import (
-	"bytes"
 	"go/token"
 	"regexp"
 	"strings"
@@ -9,8 +8,20 @@ import (
 
 // Program is a sequence of Whitespace tokens with file information.
 type Program struct {
-	Tokens []*Token
-	File   *token.File
+	Tokens   []*Token
+	File     *token.File
+	FileSet  *token.FileSet // Set of files when assembled from multiple files
+	Lang     Lang           // Accepted instructions when lowering; zero for all
+	Trailing string         // Trivia of source without tokens
+}
+
+// Position converts a position in the program source to a
+// token.Position.
+func (p *Program) Position(pos token.Pos) token.Position {
+	if p.FileSet != nil {
+		return p.FileSet.Position(pos)
+	}
+	return p.File.Position(pos)
 }
 
 // Dump formats a program as Whitespace assembly.
@@ -53,7 +64,7 @@ func (p *Program) DumpPos() string {
 			b.WriteString(padding[:padWidth-l])
 		}
 		b.WriteString(" ; ")
-		pos := p.File.Position(tok.Pos)
+		pos := p.Position(tok.Pos)
 		pos.Filename = ""
 		b.WriteString(pos.String())
 		b.WriteByte('\n')
@@ -63,23 +74,32 @@ func (p *Program) DumpPos() string {
 
 var spacePattern = regexp.MustCompile("[ \t\n]+")
 
-// DumpCommented formats a program as Whitesapce assembly with comments
-// interspersed.
-func (p *Program) DumpCommented(src []byte, indent string) string {
+// DumpCommented formats a program as Whitesapce assembly with the
+// comments from its trivia interspersed.
+func (p *Program) DumpCommented(indent string) string {
 	var b strings.Builder
-	start := 0
+	var prev *Token
 	for i, tok := range p.Tokens {
-		end := p.File.Offset(tok.End)
+		var comment strings.Builder
+		if prev != nil {
+			comment.WriteString(prev.Trailing)
+		}
+		comment.WriteString(tok.Leading)
+		for _, t := range tok.Inner {
+			comment.WriteByte(' ')
+			comment.WriteString(t.Text)
+		}
 		if i == len(p.Tokens)-1 {
-			end = p.File.Size()
+			comment.WriteByte(' ')
+			comment.WriteString(tok.Trailing)
 		}
-		comment := bytes.TrimSpace(spacePattern.ReplaceAll(src[start:end], []byte{' '}))
-		if len(comment) != 0 {
+		text := strings.TrimSpace(spacePattern.ReplaceAllString(comment.String(), " "))
+		if len(text) != 0 {
 			if tok.Type != Label {
 				b.WriteString(indent)
 			}
 			b.WriteString("; ")
-			b.Write(comment)
+			b.WriteString(text)
 			b.WriteByte('\n')
 		}
 		if tok.Type == Label {
@@ -90,8 +110,34 @@ func (p *Program) DumpCommented(src []byte, indent string) string {
 			b.WriteString(tok.String())
 		}
 		b.WriteByte('\n')
-		start = end
+		prev = tok
+	}
+	return b.String()
+}
+
+// DumpSource formats a program as Whitespace in the given encoding
+// with the trivia of each token, so that an unmodified lexed program
+// reproduces its source byte for byte. Inner trivia is kept in place
+// when a token is modified, or at its end when the token has become
+// shorter.
+func (p *Program) DumpSource(enc *Encoding) string {
+	var b strings.Builder
+	for _, tok := range p.Tokens {
+		b.WriteString(tok.Leading)
+		inner := tok.Inner
+		for i, c := range tok.sourceWS() {
+			for len(inner) != 0 && inner[0].Index <= i {
+				b.WriteString(inner[0].Text)
+				inner = inner[1:]
+			}
+			b.WriteString(enc.Encode(string(c)))
+		}
+		for _, t := range inner {
+			b.WriteString(t.Text)
+		}
+		b.WriteString(tok.Trailing)
 	}
+	b.WriteString(p.Trailing)
 	return b.String()
 }
 
@@ -104,6 +150,33 @@ func (p *Program) DumpWS() string {
 	return b.String()
 }
 
+// DumpWSEncoding formats a program as Whitespace in the given encoding.
+// When the encoding is visible, each token is written on its own line.
+func (p *Program) DumpWSEncoding(enc *Encoding) string {
+	if enc == StdEncoding {
+		return p.DumpWS()
+	}
+	visible := enc.isVisible()
+	var b strings.Builder
+	for _, tok := range p.Tokens {
+		b.WriteString(enc.Encode(tok.StringWS()))
+		if visible {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// sourceWS returns the instruction characters of the token as lexed,
+// unless the token has been modified.
+func (tok *Token) sourceWS() string {
+	if l := tok.lexed; l != nil && l.Type == tok.Type &&
+		(l.Arg == nil && tok.Arg == nil || l.Arg != nil && tok.Arg != nil && l.Arg.Cmp(tok.Arg) == 0) {
+		return l.WS
+	}
+	return tok.StringWS()
+}
+
 func (p *Program) String() string {
 	return p.Dump("    ")
 }
@@ -7,15 +7,70 @@ import (
 	"go/token"
 	"math/big"
 	"strings"
+
+	"github.com/andrewarchi/nebula/ir"
 )
 
 // Token is a lexical token in Whitespace.
 type Token struct {
 	Type      Type
 	Arg       *big.Int
-	ArgString string    // Label string, if exists
-	Pos       token.Pos // Start position in source
-	End       token.Pos // End position in source (exclusive)
+	ArgString string          // Label string, if exists
+	Pos       token.Pos       // Start position in source
+	End       token.Pos       // End position in source (exclusive)
+	Expansion *Expansion      // Macro expansion producing token, if any
+	Meta      *ir.Annotations // Label annotations, if any
+	Asserts   []*Assertion    // Assertions checked before token
+	Leading   string          // Trivia before token
+	Inner     []Trivia        // Trivia between characters of token
+	Trailing  string          // Trivia after token to end of line
+	lexed     *lexedToken     // Token as lexed, if lexed
+}
+
+// lexedToken is a token as lexed with its instruction characters,
+// which may not be canonical, such as numbers with leading zeros.
+type lexedToken struct {
+	Type Type
+	Arg  *big.Int
+	WS   string
+}
+
+// Trivia is source text within a token that is not an instruction
+// character, such as a comment.
+type Trivia struct {
+	Index int // Number of instruction characters preceding trivia
+	Text  string
+}
+
+// Assertion is an inline assertion from assembly source that compares
+// two operands before a token executes.
+type Assertion struct {
+	Op   ir.CmpOp
+	Args [2]AssertArg
+	Pos  token.Pos
+}
+
+// AssertArg is an assertion operand, either a constant or a value on
+// the stack.
+type AssertArg struct {
+	Int  *big.Int // Constant, if non-nil
+	Slot uint     // Stack position, counting from 0 at the top
+}
+
+func (arg AssertArg) String() string {
+	if arg.Int != nil {
+		return arg.Int.String()
+	}
+	return fmt.Sprintf("s%d", arg.Slot)
+}
+
+// Expansion is a macro expansion in assembly source. Tokens produced
+// by an expansion are positioned in the macro definition and refer to
+// the expansion for the use site.
+type Expansion struct {
+	Name   string     // Macro name
+	Pos    token.Pos  // Position of macro use
+	Parent *Expansion // Enclosing expansion, if nested
 }
 
 func (tok *Token) String() string {
@@ -224,6 +279,8 @@ func (typ Type) StringWS() string {
 		return " \n\n"
 	case Slide:
 		return " \t\n"
+	case Shuffle:
+		return " \t\t "
 	case Add:
 		return "\t   "
 	case Sub:
@@ -260,6 +317,12 @@ func (typ Type) StringWS() string {
 		return "\t\n\t "
 	case Readi:
 		return "\t\n\t\t"
+	case Trace:
+		return "\n\n\t"
+	case DumpStack:
+		return "\n\n   "
+	case DumpHeap:
+		return "\n\n  \t"
 	}
 	return fmt.Sprintf("token(%d)", int(typ))
 }
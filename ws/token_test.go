@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"go/token"
 	"math/big"
 	"testing"
 )
@@ -98,3 +99,22 @@ func TestInstrTypeString(t *testing.T) {
 		}
 	}
 }
+
+func TestTypeStringWS(t *testing.T) {
+	for typ := Push; typ <= DumpHeap; typ++ {
+		tok := &Token{Type: typ}
+		if typ.HasArg() {
+			tok.Arg = big.NewInt(5)
+		}
+		src := []byte(tok.StringWS())
+		file := token.NewFileSet().AddFile("test.ws", -1, len(src))
+		tokens, err := LexTokens(file, src)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", typ, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Type != typ {
+			t.Errorf("%v: StringWS() = %q lexes as %v", typ, src, tokens)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package wsa
+
+import (
+	"go/token"
+	"regexp"
+	"strconv"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/syntax"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// parseAnnotation parses a compiler annotation:
+//
+//	@stack N -> M   routine consumes N values and leaves M
+//	@pure           routine has no I/O or heap stores
+//	@noreturn       routine never returns to its caller
+//	@assert A op B  condition holds before the next instruction
+//
+// Label annotations apply to the following label and assertions to the
+// following instruction. Assertion operands are constants or stack
+// slots s0, s1, ..., counting from the top.
+func (p *parser) parseAnnotation() {
+	pos := p.tok.pos
+	p.next()
+	if p.tok.tok != syntax.Ident {
+		p.errorf("expected annotation, found %s", p.tokenString())
+		return
+	}
+	name := p.tok.lit
+	p.next()
+	if name == "assert" {
+		p.parseAssert(pos)
+		return
+	}
+	if p.meta == nil {
+		p.meta = &ir.Annotations{Pos: pos}
+	}
+	switch name {
+	case "stack":
+		pops := p.parseUint()
+		if p.tok.tok != syntax.Arrow {
+			p.errorf("expected ->, found %s", p.tokenString())
+			return
+		}
+		p.next()
+		pushes := p.parseUint()
+		p.meta.Stack = &ir.StackSig{Pops: pops, Pushes: pushes, Pos: pos}
+	case "pure":
+		p.meta.Pure = true
+	case "noreturn":
+		p.meta.NoReturn = true
+	default:
+		p.errorAt(pos, "unknown annotation: @%s", name)
+	}
+}
+
+// parseAssert parses the condition of an assertion.
+func (p *parser) parseAssert(pos token.Pos) {
+	lhs := p.parseAssertArg()
+	if p.tok.tok != syntax.Op {
+		p.errorf("expected comparison, found %s", p.tokenString())
+		return
+	}
+	op, ok := cmpOps[p.tok.op]
+	if !ok {
+		p.errorf("expected comparison, found %s", p.tokenString())
+		return
+	}
+	p.next()
+	rhs := p.parseAssertArg()
+	p.asserts = append(p.asserts, &ws.Assertion{Op: op, Args: [2]ws.AssertArg{lhs, rhs}, Pos: pos})
+}
+
+var slotPattern = regexp.MustCompile(`^s[0-9]+$`)
+
+// parseAssertArg parses an assertion operand, which is either a stack
+// slot or a constant integer expression.
+func (p *parser) parseAssertArg() ws.AssertArg {
+	if p.tok.tok == syntax.Ident && slotPattern.MatchString(p.tok.lit) {
+		if _, ok := p.defs[p.tok.lit]; !ok {
+			slot, err := strconv.ParseUint(p.tok.lit[1:], 10, 0)
+			if err != nil {
+				p.errorf("invalid stack slot: %s", p.tok.lit)
+			}
+			p.next()
+			return ws.AssertArg{Slot: uint(slot)}
+		}
+	}
+	return ws.AssertArg{Int: p.parseInt()}
+}
+
+// parseUint parses a constant non-negative integer expression that
+// fits in a uint.
+func (p *parser) parseUint() uint {
+	pos := p.tok.pos
+	x := p.parseInt()
+	if x.Sign() == -1 || !x.IsUint64() || uint64(uint(x.Uint64())) != x.Uint64() {
+		p.errorAt(pos, "integer out of range: %v", x)
+		return 0
+	}
+	return uint(x.Uint64())
+}
+
+// attachAnnotations attaches pending annotations to a token.
+func (p *parser) attachAnnotations(tok *ws.Token) {
+	if p.meta != nil {
+		if tok.Type == ws.Label {
+			tok.Meta = p.meta
+		} else {
+			p.errorAt(p.meta.Pos, "annotation must precede a label")
+		}
+		p.meta = nil
+	}
+	tok.Asserts, p.asserts = p.asserts, nil
+}
+
+// checkAnnotations reports annotations that are not followed by a
+// token.
+func (p *parser) checkAnnotations() {
+	if p.meta != nil {
+		p.errorAt(p.meta.Pos, "annotation must precede a label")
+	} else if len(p.asserts) != 0 {
+		p.errorAt(p.asserts[0].Pos, "assertion must precede an instruction")
+	}
+}
+
+var cmpOps = map[syntax.Operator]ir.CmpOp{
+	syntax.Eql: ir.Eq,
+	syntax.Neq: ir.Ne,
+	syntax.Lss: ir.Lt,
+	syntax.Leq: ir.Le,
+	syntax.Gtr: ir.Gt,
+	syntax.Geq: ir.Ge,
+}
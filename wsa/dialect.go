@@ -0,0 +1,355 @@
+package wsa
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/andrewarchi/nebula/syntax"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// Dialect is a Whitespace assembly syntax. Dialects differ in
+// instruction mnemonics, comment syntax, label syntax, and literals.
+type Dialect uint8
+
+// Whitespace assembly dialects.
+const (
+	Auto      Dialect = iota // Detect dialect from source
+	Nebula                   // Nebula assembly
+	Whitelips                // Whitelips IDE assembly
+	Burghard                 // Oliver Burghard's wsa assembly
+	Rosetta                  // Assembly of Rosetta Code Whitespace tasks
+)
+
+var dialectNames = []string{
+	Auto:      "auto",
+	Nebula:    "nebula",
+	Whitelips: "whitelips",
+	Burghard:  "burghard",
+	Rosetta:   "rosetta",
+}
+
+func (d Dialect) String() string {
+	if int(d) < len(dialectNames) {
+		return dialectNames[d]
+	}
+	return fmt.Sprintf("Dialect(%d)", d)
+}
+
+// LookupDialect returns the dialect with the given name.
+func LookupDialect(name string) (Dialect, bool) {
+	for d, n := range dialectNames {
+		if n == name {
+			return Dialect(d), true
+		}
+	}
+	return Auto, false
+}
+
+// DialectNames returns the names of all dialects, including auto.
+func DialectNames() []string {
+	return append([]string(nil), dialectNames...)
+}
+
+// syntaxRules are the syntax rules of a dialect.
+type syntaxRules struct {
+	insts        map[string]ws.Type
+	mnemonics    map[ws.Type]string // preferred mnemonics, when not canonical
+	mode         uint               // scanner mode
+	foldCase     bool               // mnemonics are case-insensitive
+	colonLabels  bool               // labels are declared with "name:"
+	labelKeyword bool               // labels are declared with "label name"
+	intBase      int                // base of integer literals; 0 for prefix-selected
+	charIdents   bool               // single-letter names are character literals
+	pushStrings  bool               // push "str" pushes characters, first on top
+	pseudoInsts  bool               // printstr and storestr pseudo-instructions
+	charLits     bool               // printed characters are formatted as 'c'
+	numLabels    bool               // labels are printed as numbers
+}
+
+var dialects = [...]*syntaxRules{
+	Nebula: {
+		insts:        nebulaInsts,
+		colonLabels:  true,
+		labelKeyword: true,
+		pushStrings:  true,
+		pseudoInsts:  true,
+	},
+	Whitelips: {
+		insts:       whitelipsInsts,
+		mode:        syntax.SemiComment,
+		colonLabels: true,
+		charLits:    true,
+	},
+	Burghard: {
+		insts:        burghardInsts,
+		mnemonics:    burghardMnemonics,
+		mode:         syntax.SemiComment,
+		foldCase:     true,
+		labelKeyword: true,
+		intBase:      10,
+	},
+	Rosetta: {
+		insts:       rosettaInsts,
+		mnemonics:   rosettaMnemonics,
+		mode:        syntax.SemiComment,
+		colonLabels: true,
+		intBase:     10,
+		charIdents:  true,
+		pushStrings: true,
+		numLabels:   true,
+	},
+}
+
+// lookupInst returns the instruction type for a mnemonic.
+func (r *syntaxRules) lookupInst(name string) (ws.Type, bool) {
+	if r.foldCase {
+		name = strings.ToLower(name)
+	}
+	typ, ok := r.insts[name]
+	if ok && typ == ws.Label && !r.labelKeyword {
+		return 0, false
+	}
+	return typ, ok
+}
+
+// mnemonic returns the preferred mnemonic for an instruction type.
+func (r *syntaxRules) mnemonic(typ ws.Type) (string, bool) {
+	if name, ok := r.mnemonics[typ]; ok {
+		return name, true
+	}
+	name := typ.String()
+	if t, ok := r.lookupInst(name); ok && t == typ {
+		return name, true
+	}
+	return "", false
+}
+
+// isInst reports whether name is an instruction in any dialect.
+func isInst(name string) bool {
+	for _, r := range dialects[Nebula:] {
+		if _, ok := r.lookupInst(name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirective reports whether name is an assembler directive.
+func isDirective(name string) bool {
+	switch name {
+	case "define", "macro", "include", "printstr", "storestr":
+		return true
+	}
+	return false
+}
+
+// DetectDialect guesses the dialect of assembly source. Mnemonics
+// unique to a dialect take precedence, then the use of ';' for
+// comments, rather than as an instruction separator, distinguishes
+// Whitelips from Nebula.
+func DetectDialect(src []byte) Dialect {
+	lines := bytes.Split(src, []byte{'\n'})
+	macros := make(map[string]bool)
+	for _, line := range lines {
+		if words := strings.Fields(string(line)); len(words) > 1 && words[0] == "macro" {
+			macros[words[1]] = true
+		}
+	}
+	semiComment := false
+	var rosetta, burghard int
+	for _, line := range lines {
+		if i := bytes.IndexByte(line, '#'); i != -1 && !bytes.ContainsAny(line[:i], `'"`) {
+			line = line[:i]
+		}
+		segments := bytes.Split(line, []byte{';'})
+		for i, seg := range segments {
+			words := strings.Fields(string(seg))
+			if i != 0 && len(words) != 0 && !isInst(words[0]) && !isDirective(words[0]) && !macros[words[0]] &&
+				!strings.HasSuffix(words[0], ":") && !bytes.ContainsAny(seg, `'"`) {
+				semiComment = true
+				break
+			}
+			for j, word := range words {
+				switch strings.ToLower(word) {
+				case "ochr", "onum", "ichr", "inum", "exch", "prtc":
+					rosetta++
+				case "doub", "retrive", "outc", "outn", "inc", "inn",
+					"debug_printstack", "debug_printheap":
+					burghard++
+				case "label":
+					if j == 0 && len(words) > 1 {
+						burghard++
+					}
+				}
+			}
+		}
+	}
+	switch {
+	case rosetta > burghard:
+		return Rosetta
+	case burghard != 0:
+		return Burghard
+	case semiComment:
+		return Whitelips
+	}
+	return Nebula
+}
+
+var nebulaInsts = map[string]ws.Type{
+	"push":      ws.Push,
+	"dup":       ws.Dup,
+	"copy":      ws.Copy,
+	"swap":      ws.Swap,
+	"drop":      ws.Drop,
+	"slide":     ws.Slide,
+	"shuffle":   ws.Shuffle,
+	"add":       ws.Add,
+	"sub":       ws.Sub,
+	"mul":       ws.Mul,
+	"div":       ws.Div,
+	"mod":       ws.Mod,
+	"store":     ws.Store,
+	"retrieve":  ws.Retrieve,
+	"label":     ws.Label,
+	"call":      ws.Call,
+	"jmp":       ws.Jmp,
+	"jz":        ws.Jz,
+	"jn":        ws.Jn,
+	"ret":       ws.Ret,
+	"end":       ws.End,
+	"printc":    ws.Printc,
+	"printi":    ws.Printi,
+	"readc":     ws.Readc,
+	"readi":     ws.Readi,
+	"trace":     ws.Trace,
+	"dumpstack": ws.DumpStack,
+	"dumpheap":  ws.DumpHeap,
+
+	// Aliases
+	"duplicate": ws.Dup,
+	"load":      ws.Retrieve,
+	"return":    ws.Ret,
+	"halt":      ws.End,
+	"putc":      ws.Printc,
+	"puti":      ws.Printi,
+	"putn":      ws.Printi,
+	"outi":      ws.Printi,
+	"getc":      ws.Readc,
+	"geti":      ws.Readi,
+	"getn":      ws.Readi,
+	"ini":       ws.Readi,
+}
+
+var whitelipsInsts = map[string]ws.Type{
+	"push":     ws.Push,
+	"dup":      ws.Dup,
+	"copy":     ws.Copy,
+	"swap":     ws.Swap,
+	"drop":     ws.Drop,
+	"slide":    ws.Slide,
+	"add":      ws.Add,
+	"sub":      ws.Sub,
+	"mul":      ws.Mul,
+	"div":      ws.Div,
+	"mod":      ws.Mod,
+	"store":    ws.Store,
+	"retrieve": ws.Retrieve,
+	"call":     ws.Call,
+	"jmp":      ws.Jmp,
+	"jz":       ws.Jz,
+	"jn":       ws.Jn,
+	"ret":      ws.Ret,
+	"end":      ws.End,
+	"printc":   ws.Printc,
+	"printi":   ws.Printi,
+	"readc":    ws.Readc,
+	"readi":    ws.Readi,
+}
+
+var burghardInsts = map[string]ws.Type{
+	"push":             ws.Push,
+	"doub":             ws.Dup,
+	"copy":             ws.Copy,
+	"swap":             ws.Swap,
+	"pop":              ws.Drop,
+	"slide":            ws.Slide,
+	"add":              ws.Add,
+	"sub":              ws.Sub,
+	"mul":              ws.Mul,
+	"div":              ws.Div,
+	"mod":              ws.Mod,
+	"store":            ws.Store,
+	"retrive":          ws.Retrieve,
+	"label":            ws.Label,
+	"call":             ws.Call,
+	"jump":             ws.Jmp,
+	"jumpz":            ws.Jz,
+	"jumpn":            ws.Jn,
+	"ret":              ws.Ret,
+	"exit":             ws.End,
+	"outc":             ws.Printc,
+	"outn":             ws.Printi,
+	"inc":              ws.Readc,
+	"inn":              ws.Readi,
+	"debug_printstack": ws.DumpStack,
+	"debug_printheap":  ws.DumpHeap,
+}
+
+var rosettaInsts = map[string]ws.Type{
+	"push":  ws.Push,
+	"dup":   ws.Dup,
+	"copy":  ws.Copy,
+	"exch":  ws.Swap,
+	"swap":  ws.Swap,
+	"pop":   ws.Drop,
+	"slide": ws.Slide,
+	"add":   ws.Add,
+	"sub":   ws.Sub,
+	"mul":   ws.Mul,
+	"div":   ws.Div,
+	"mod":   ws.Mod,
+	"store": ws.Store,
+	"load":  ws.Retrieve,
+	"call":  ws.Call,
+	"jump":  ws.Jmp,
+	"jz":    ws.Jz,
+	"jumpz": ws.Jz,
+	"jn":    ws.Jn,
+	"jumpn": ws.Jn,
+	"ret":   ws.Ret,
+	"exit":  ws.End,
+	"ochr":  ws.Printc,
+	"prtc":  ws.Printc,
+	"onum":  ws.Printi,
+	"ichr":  ws.Readc,
+	"inum":  ws.Readi,
+}
+
+var burghardMnemonics = map[ws.Type]string{
+	ws.Dup:       "doub",
+	ws.Drop:      "pop",
+	ws.Retrieve:  "retrive",
+	ws.Jmp:       "jump",
+	ws.Jz:        "jumpz",
+	ws.Jn:        "jumpn",
+	ws.End:       "exit",
+	ws.Printc:    "outC",
+	ws.Printi:    "outN",
+	ws.Readc:     "inC",
+	ws.Readi:     "inN",
+	ws.DumpStack: "debug_printstack",
+	ws.DumpHeap:  "debug_printheap",
+}
+
+var rosettaMnemonics = map[ws.Type]string{
+	ws.Drop:     "pop",
+	ws.Retrieve: "load",
+	ws.Jmp:      "jump",
+	ws.End:      "exit",
+	ws.Printc:   "ochr",
+	ws.Printi:   "onum",
+	ws.Readc:    "ichr",
+	ws.Readi:    "inum",
+}
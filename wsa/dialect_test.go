@@ -0,0 +1,99 @@
+package wsa
+
+import (
+	"go/token"
+	"testing"
+)
+
+var dialectTests = []struct {
+	Dialect Dialect
+	Src     string
+}{
+	{Nebula, `# Print "Hi" and read a number
+    push 'i'; push 'H'
+loop:
+    dup; jz done
+    printc; jmp loop
+done:
+    drop; push 0; readi; end
+`},
+	{Whitelips, `; Print "Hi" and read a number
+    push 'i'
+    push 'H'
+loop:
+    dup
+    jz done   ; stop at zero
+    printc
+    jmp loop
+done:
+    drop
+    push 0
+    readi
+    end
+`},
+	{Burghard, `; Print "Hi" and read a number
+    push 105
+    push 72
+label loop
+    doub
+    jumpz done ; stop at zero
+    outC
+    jump loop
+label done
+    pop
+    push 0
+    inN
+    exit
+`},
+	{Rosetta, `; Print "Hi" and read a number
+push "Hi"
+0:
+    dup jumpz 1 ; stop at zero
+    prtc jump 0
+1:
+    pop push 0 inum exit
+`},
+}
+
+func TestParseDialect(t *testing.T) {
+	want := "   \t\t \t  \t\n   \t  \t   \n\n  \n \n \n\t \t\n\t\n  \n \n\n\n  \t\n \n\n   \n\t\n\t\t\n\n\n"
+	for _, test := range dialectTests {
+		for _, d := range []Dialect{test.Dialect, Auto} {
+			program, err := ParseDialect(token.NewFileSet(), "test.wsa", []byte(test.Src), d)
+			if err != nil {
+				t.Errorf("%v (%v): unexpected error: %v", test.Dialect, d, err)
+				continue
+			}
+			if got := program.DumpWS(); got != want {
+				t.Errorf("%v (%v): got %q, want %q", test.Dialect, d, got, want)
+			}
+		}
+	}
+}
+
+func TestDetectDialect(t *testing.T) {
+	for _, test := range dialectTests {
+		if d := DetectDialect([]byte(test.Src)); d != test.Dialect {
+			t.Errorf("got %v, want %v for source:\n%s", d, test.Dialect, test.Src)
+		}
+	}
+}
+
+func TestParseDialectError(t *testing.T) {
+	tests := []struct {
+		Dialect  Dialect
+		Src, Err string
+	}{
+		{Whitelips, "shuffle", "test.wsa:1:1: unrecognized instruction: shuffle"},
+		{Whitelips, "label x", "test.wsa:1:1: unrecognized instruction: label"},
+		{Burghard, "x:", "test.wsa:1:1: label declarations use label keyword"},
+		{Burghard, "push 0x10", "test.wsa:1:6: invalid integer: 0x10"},
+		{Nebula, "ochr", "test.wsa:1:1: unrecognized instruction: ochr"},
+	}
+	for i, test := range tests {
+		_, err := ParseDialect(token.NewFileSet(), "test.wsa", []byte(test.Src), test.Dialect)
+		if err == nil || err.Error() != test.Err {
+			t.Errorf("test %d: got error %v, want %s", i+1, err, test.Err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package wsa
+
+import (
+	"go/token"
+	"math/big"
+	"unicode/utf8"
+
+	"github.com/andrewarchi/nebula/syntax"
+)
+
+// value is the result of a constant expression. It is either an
+// integer or a label name. A value with neither is invalid and has
+// already been reported.
+type value struct {
+	Int   *big.Int
+	Label string
+	Ident string    // Identifier that the label was derived from
+	Pos   token.Pos // Position of the identifier
+}
+
+// definition is a constant declared with define.
+type definition struct {
+	value
+	Pos token.Pos
+}
+
+// parseDefine parses a constant definition of the form
+// "define NAME expr".
+func (p *parser) parseDefine() {
+	if p.tok.tok != syntax.Ident {
+		p.errorf("expected name, found %s", p.tokenString())
+		return
+	}
+	name, pos := p.tok.lit, p.tok.pos
+	p.next()
+	val := p.parseExpr()
+	if def, ok := p.defs[name]; ok {
+		p.errorAt(pos, "%s redefined; previous definition at %v", name, p.syntaxPos(def.Pos))
+		return
+	}
+	p.defs[name] = &definition{val, pos}
+}
+
+// parseExpr parses an additive expression.
+func (p *parser) parseExpr() value {
+	x := p.parseTerm()
+	for p.tok.tok == syntax.Op && (p.tok.op == syntax.Add || p.tok.op == syntax.Sub) {
+		op, pos := p.tok.op, p.tok.pos
+		p.next()
+		x = p.binaryOp(op, x, p.parseTerm(), pos)
+	}
+	return x
+}
+
+// parseTerm parses a multiplicative expression.
+func (p *parser) parseTerm() value {
+	x := p.parseUnaryExpr()
+	for p.tok.tok == syntax.Op && (p.tok.op == syntax.Mul || p.tok.op == syntax.Div || p.tok.op == syntax.Rem) {
+		op, pos := p.tok.op, p.tok.pos
+		p.next()
+		x = p.binaryOp(op, x, p.parseUnaryExpr(), pos)
+	}
+	return x
+}
+
+// parseUnaryExpr parses a signed operand.
+func (p *parser) parseUnaryExpr() value {
+	if p.tok.tok == syntax.Op && (p.tok.op == syntax.Add || p.tok.op == syntax.Sub) {
+		op := p.tok.op
+		p.next()
+		x := p.parseUnaryExpr()
+		if !p.checkInt(x) {
+			return value{}
+		}
+		if op == syntax.Sub {
+			x.Int = new(big.Int).Neg(x.Int)
+		}
+		return x
+	}
+	return p.parseOperand()
+}
+
+// parseOperand parses an integer, character, name, or parenthesized
+// expression.
+func (p *parser) parseOperand() value {
+	switch p.tok.tok {
+	case syntax.Int:
+		x := p.parseIntLit()
+		p.next()
+		return value{Int: x}
+	case syntax.Rune:
+		x := p.parseRuneLit()
+		p.next()
+		return value{Int: x}
+	case syntax.Ident:
+		name, pos, exp := p.tok.lit, p.tok.pos, p.tok.exp
+		p.next()
+		if x, ok := exp.lookup(name); ok {
+			return x
+		}
+		if def, ok := p.defs[name]; ok {
+			x := def.value
+			if x.Label != "" {
+				x.Ident, x.Pos = name, pos
+			}
+			return x
+		}
+		if p.rules.charIdents && utf8.RuneCountInString(name) == 1 {
+			r, _ := utf8.DecodeRuneInString(name)
+			return value{Int: big.NewInt(int64(r))}
+		}
+		return value{Label: name, Ident: name, Pos: pos}
+	case syntax.Lparen:
+		p.next()
+		x := p.parseExpr()
+		if p.tok.tok != syntax.Rparen {
+			p.errorf("expected ), found %s", p.tokenString())
+			return value{}
+		}
+		p.next()
+		return x
+	}
+	p.errorf("expected integer, found %s", p.tokenString())
+	return value{}
+}
+
+func (p *parser) binaryOp(op syntax.Operator, x, y value, pos token.Pos) value {
+	if !p.checkInt(x) || !p.checkInt(y) {
+		return value{}
+	}
+	z := new(big.Int)
+	switch op {
+	case syntax.Add:
+		z.Add(x.Int, y.Int)
+	case syntax.Sub:
+		z.Sub(x.Int, y.Int)
+	case syntax.Mul:
+		z.Mul(x.Int, y.Int)
+	case syntax.Div, syntax.Rem:
+		if y.Int.Sign() == 0 {
+			p.errorAt(pos, "division by zero")
+			return value{}
+		}
+		if op == syntax.Div {
+			z.Div(x.Int, y.Int)
+		} else {
+			z.Mod(x.Int, y.Int)
+		}
+	}
+	return value{Int: z}
+}
+
+// checkInt reports an error when x is not an integer.
+func (p *parser) checkInt(x value) bool {
+	if x.Int != nil {
+		return true
+	}
+	if x.Label != "" {
+		if _, ok := p.defs[x.Ident]; ok {
+			p.errorAt(x.Pos, "%s is a label, not an integer", x.Ident)
+		} else {
+			p.errorAt(x.Pos, "undefined: %s", x.Ident)
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package wsa
+
+import (
+	"math/big"
+	"strings"
+
+	"github.com/andrewarchi/nebula/internal/bigint"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// isLocal reports whether a label name is local, i.e., dot-prefixed.
+// Local labels are scoped to the nearest preceding global label.
+func isLocal(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// resolveLabels assigns IDs to named labels in order of first
+// appearance, skipping IDs already used by numbered labels. Local
+// labels are qualified by their scope. A reference to a local label
+// that is not declared in its scope resolves to the declaration in
+// another scope, when there is only one. A local label keeps its name
+// unless the same name is declared in multiple scopes, in which case
+// it is named by its qualified name, such as "fn.loop". A label
+// declared twice in the same scope is an error.
+func (p *parser) resolveLabels() {
+	keys := make([]string, len(p.tokens))
+	defined := make(map[string]*ws.Token)
+	scopes := make(map[string][]string) // local name to qualified names
+	scope := ""
+	for i, tok := range p.tokens {
+		if !tok.Type.IsControl() || tok.ArgString == "" {
+			continue
+		}
+		name := tok.ArgString
+		local := isLocal(name)
+		if tok.Type == ws.Label && !local {
+			scope = name
+		}
+		keys[i] = name
+		if local {
+			keys[i] = scope + name
+		}
+		if tok.Type == ws.Label {
+			if prev := defined[keys[i]]; prev != nil {
+				p.errorAtToken(tok, "label %s redefined; previous definition at %v",
+					name, p.fset.Position(prev.Pos))
+				continue
+			}
+			defined[keys[i]] = tok
+			if local {
+				scopes[name] = append(scopes[name], keys[i])
+			}
+		}
+	}
+
+	used := bigint.NewMap() // map[*big.Int]nil
+	for _, tok := range p.tokens {
+		if tok.Type.IsControl() && tok.Arg != nil {
+			used.Put(tok.Arg, nil)
+		}
+	}
+	ids := make(map[string]*big.Int)
+	next := new(big.Int)
+	for i, tok := range p.tokens {
+		key := keys[i]
+		if key == "" {
+			continue
+		}
+		if defined[key] == nil {
+			switch decls := scopes[tok.ArgString]; {
+			case len(decls) == 1:
+				key = decls[0]
+			case len(decls) > 1:
+				p.errorAtToken(tok, "ambiguous label: %s declared in %d scopes", tok.ArgString, len(decls))
+			default:
+				p.errorAtToken(tok, "undefined label: %s", tok.ArgString)
+			}
+		}
+		id, ok := ids[key]
+		if !ok {
+			for used.Has(next) {
+				next.Add(next, bigOne)
+			}
+			id = new(big.Int).Set(next)
+			ids[key] = id
+			used.Put(id, nil)
+		}
+		tok.Arg = id
+		if isLocal(tok.ArgString) && len(scopes[tok.ArgString]) > 1 {
+			tok.ArgString = key
+		}
+	}
+}
+
+var bigOne = big.NewInt(1)
@@ -0,0 +1,140 @@
+package wsa
+
+import (
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+
+	"github.com/andrewarchi/nebula/syntax"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// macro is a parameterized sequence of tokens declared with macro.
+type macro struct {
+	Name   string
+	Params []string
+	Body   []item
+	Pos    token.Pos
+}
+
+// expansion is an active macro expansion with its bound arguments.
+type expansion struct {
+	macro  *macro
+	args   map[string]value
+	exp    *ws.Expansion
+	parent *expansion
+}
+
+// lookup returns the argument bound to a macro parameter.
+func (e *expansion) lookup(name string) (value, bool) {
+	if e == nil {
+		return value{}, false
+	}
+	x, ok := e.args[name]
+	return x, ok
+}
+
+// parseMacro parses a macro definition of the form
+// "macro NAME param... { body }".
+func (p *parser) parseMacro() {
+	if p.tok.tok != syntax.Ident {
+		p.errorf("expected name, found %s", p.tokenString())
+		return
+	}
+	name, pos := p.tok.lit, p.tok.pos
+	p.next()
+	var params []string
+	for p.tok.tok == syntax.Ident {
+		params = append(params, p.tok.lit)
+		p.next()
+	}
+	if p.tok.tok != syntax.Lbrace {
+		p.errorf("expected {, found %s", p.tokenString())
+		return
+	}
+	p.next()
+	var body []item
+	for depth := 0; ; {
+		switch p.tok.tok {
+		case syntax.EOF:
+			p.errorf("unterminated macro %s", name)
+			return
+		case syntax.Lbrace:
+			depth++
+		case syntax.Rbrace:
+			depth--
+		}
+		if depth < 0 {
+			break
+		}
+		body = append(body, p.tok)
+		p.next()
+	}
+	p.next()
+	if _, ok := p.rules.lookupInst(name); ok {
+		p.errorAt(pos, "macro %s conflicts with instruction", name)
+		return
+	}
+	if m, ok := p.macros[name]; ok {
+		p.errorAt(pos, "macro %s redefined; previous definition at %v", name, p.syntaxPos(m.Pos))
+		return
+	}
+	p.macros[name] = &macro{name, params, body, pos}
+}
+
+// expandMacro parses the arguments to a macro use and replays the
+// macro body in their scope.
+func (p *parser) expandMacro(m *macro, pos token.Pos, parent *expansion) {
+	for e := parent; e != nil; e = e.parent {
+		if e.macro == m {
+			p.errorAt(pos, "recursive expansion of macro %s", m.Name)
+			return
+		}
+	}
+	args := make(map[string]value, len(m.Params))
+	for _, param := range m.Params {
+		args[param] = p.parseExpr()
+	}
+	e := &expansion{macro: m, args: args, parent: parent}
+	e.exp = &ws.Expansion{Name: m.Name, Pos: pos}
+	if parent != nil {
+		e.exp.Parent = parent.exp
+	}
+	body := make([]item, len(m.Body))
+	copy(body, m.Body)
+	p.push(&replaySource{items: body, exp: e})
+}
+
+// parseInclude parses a file inclusion of the form "include path".
+// Relative paths are resolved from the directory of the including
+// file.
+func (p *parser) parseInclude() {
+	if p.tok.tok != syntax.String {
+		p.errorf("expected file path, found %s", p.tokenString())
+		return
+	}
+	path, err := strconv.Unquote(p.tok.lit)
+	if err != nil {
+		p.errorf("invalid file path: %s", p.tok.lit)
+		return
+	}
+	pos := p.tok.pos
+	if !filepath.IsAbs(path) && p.tok.file != nil {
+		path = filepath.Join(filepath.Dir(p.tok.file.Name()), path)
+	}
+	for _, src := range p.sources {
+		if fs, ok := src.(*fileSource); ok && fs.file.Name() == path {
+			p.errorAt(pos, "include cycle: %s", path)
+			return
+		}
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		p.errorAt(pos, "%v", err)
+		return
+	}
+	p.next()
+	file := p.fset.AddFile(path, -1, len(src))
+	p.push(newFileSource(file, src, p.rules.mode, p.errorPos))
+}
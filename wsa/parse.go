@@ -1,61 +1,276 @@
-package wsa
-
-import "github.com/andrewarchi/nebula/ws"
-
-var instNames = map[string]ws.Type{
-	"push":      ws.Push,
-	"dup":       ws.Dup,
-	"copy":      ws.Copy,
-	"swap":      ws.Swap,
-	"drop":      ws.Drop,
-	"slide":     ws.Slide,
-	"shuffle":   ws.Shuffle,
-	"add":       ws.Add,
-	"sub":       ws.Sub,
-	"mul":       ws.Mul,
-	"div":       ws.Div,
-	"mod":       ws.Mod,
-	"store":     ws.Store,
-	"retrieve":  ws.Retrieve,
-	"label":     ws.Label,
-	"call":      ws.Call,
-	"jmp":       ws.Jmp,
-	"jz":        ws.Jz,
-	"jn":        ws.Jn,
-	"ret":       ws.Ret,
-	"end":       ws.End,
-	"printc":    ws.Printc,
-	"printi":    ws.Printi,
-	"readc":     ws.Readc,
-	"readi":     ws.Readi,
-	"trace":     ws.Trace,
-	"dumpstack": ws.DumpStack,
-	"dumpheap":  ws.DumpHeap,
-
-	// Aliases
-	"duplicate":        ws.Dup,       //
-	"doub":             ws.Dup,       // burghard
-	"pop":              ws.Drop,      // burghard
-	"load":             ws.Retrieve,  //
-	"retrive":          ws.Retrieve,  // burghard
-	"jump":             ws.Jmp,       // burghard
-	"jumpz":            ws.Jz,        // burghard
-	"jumpn":            ws.Jn,        // burghard
-	"return":           ws.Ret,       //
-	"exit":             ws.End,       // burghard
-	"halt":             ws.End,       //
-	"putc":             ws.Printc,    //
-	"outc":             ws.Printc,    // burghard
-	"puti":             ws.Printi,    //
-	"putn":             ws.Printi,    //
-	"outi":             ws.Printi,    //
-	"outn":             ws.Printi,    // burghard
-	"getc":             ws.Readc,     //
-	"inc":              ws.Readc,     // burghard
-	"geti":             ws.Readi,     //
-	"getn":             ws.Readi,     //
-	"ini":              ws.Readi,     //
-	"inn":              ws.Readi,     // burghard
-	"debug_printstack": ws.DumpStack, // burghard
-	"debug_printheap":  ws.DumpHeap,  // burghard
+// Package wsa parses Whitespace assembly source files.
+//
+package wsa // import "github.com/andrewarchi/nebula/wsa"
+
+import (
+	"fmt"
+	"go/token"
+	"math/big"
+	"strconv"
+
+	"github.com/andrewarchi/nebula/ir"
+	"github.com/andrewarchi/nebula/syntax"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// parser parses Whitespace assembly into Whitespace tokens.
+type parser struct {
+	fset    *token.FileSet
+	rules   *syntaxRules
+	sources []source // Stack of token sources; top is current
+	tok     item     // Current token
+	prev    token.Pos
+	tokens  []*ws.Token
+	defs    map[string]*definition
+	macros  map[string]*macro
+	meta    *ir.Annotations // Pending label annotations
+	asserts []*ws.Assertion // Pending assertions
+	err     error           // First error encountered
+}
+
+// Parse parses a Whitespace assembly source file into a program,
+// detecting its dialect. Labels are assigned sequential IDs in order of
+// first appearance and retain their names in ArgString. Included files
+// are added to fset.
+func Parse(fset *token.FileSet, filename string, src []byte) (*ws.Program, error) {
+	return ParseDialect(fset, filename, src, Auto)
+}
+
+// ParseDialect parses a Whitespace assembly source file in the given
+// dialect. Included files are parsed in the same dialect.
+func ParseDialect(fset *token.FileSet, filename string, src []byte, dialect Dialect) (*ws.Program, error) {
+	if dialect == Auto {
+		dialect = DetectDialect(src)
+	}
+	if int(dialect) >= len(dialects) {
+		return nil, fmt.Errorf("wsa: invalid dialect: %v", dialect)
+	}
+	file := fset.AddFile(filename, -1, len(src))
+	p := &parser{
+		fset:   fset,
+		rules:  dialects[dialect],
+		defs:   make(map[string]*definition),
+		macros: make(map[string]*macro),
+	}
+	p.sources = []source{newFileSource(file, src, p.rules.mode, p.errorPos)}
+	p.next()
+	for p.tok.tok != syntax.EOF {
+		p.parseInst()
+	}
+	p.checkAnnotations()
+	p.resolveLabels()
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &ws.Program{Tokens: p.tokens, File: file, FileSet: fset}, nil
+}
+
+func (p *parser) parseInst() {
+	switch p.tok.tok {
+	case syntax.Semi:
+		p.next()
+	case syntax.At:
+		p.parseAnnotation()
+	case syntax.Ident:
+		name, pos, exp := p.tok.lit, p.tok.pos, p.tok.exp
+		p.next()
+		if p.tok.tok == syntax.Colon {
+			if !p.rules.colonLabels {
+				p.errorAt(pos, "label declarations use label keyword")
+			}
+			p.next()
+			p.appendToken(&ws.Token{Type: ws.Label, ArgString: name, Pos: pos}, exp)
+			return
+		}
+		switch name {
+		case "define":
+			p.parseDefine()
+			return
+		case "macro":
+			p.parseMacro()
+			return
+		case "include":
+			p.parseInclude()
+			return
+		case "printstr", "storestr":
+			if p.rules.pseudoInsts {
+				p.parseStringInst(name, exp)
+				return
+			}
+		}
+		if m, ok := p.macros[name]; ok {
+			p.expandMacro(m, pos, exp)
+			return
+		}
+		typ, ok := p.rules.lookupInst(name)
+		if !ok {
+			p.errorAt(pos, "unrecognized instruction: %s", name)
+			return
+		}
+		if typ == ws.Push && p.rules.pushStrings && p.tok.tok == syntax.String {
+			p.parsePushString(exp)
+			return
+		}
+		tok := &ws.Token{Type: typ, Pos: pos}
+		if typ.HasArg() {
+			if typ.IsControl() {
+				p.parseLabelArg(tok)
+			} else {
+				tok.Arg = p.parseInt()
+			}
+		}
+		p.appendToken(tok, exp)
+	case syntax.Int:
+		pos, exp := p.tok.pos, p.tok.exp
+		label := p.parseLabelID()
+		if p.tok.tok != syntax.Colon || !p.rules.colonLabels {
+			p.errorAt(pos, "expected label or instruction, found integer")
+			return
+		}
+		p.next()
+		p.appendToken(&ws.Token{Type: ws.Label, Arg: label, Pos: pos}, exp)
+	default:
+		p.errorf("expected label or instruction, found %s", p.tokenString())
+		p.next()
+	}
+}
+
+func (p *parser) appendToken(tok *ws.Token, exp *expansion) {
+	if tok.End == token.NoPos {
+		tok.End = p.prev
+	}
+	if exp != nil {
+		tok.Expansion = exp.exp
+	}
+	p.attachAnnotations(tok)
+	p.tokens = append(p.tokens, tok)
+}
+
+// parseLabelArg parses a label argument, which is either a label name
+// or a constant expression for a numbered label.
+func (p *parser) parseLabelArg(tok *ws.Token) {
+	pos := p.tok.pos
+	x := p.parseExpr()
+	switch {
+	case x.Label != "":
+		tok.ArgString = x.Label
+	case x.Int != nil:
+		if x.Int.Sign() == -1 {
+			p.errorAt(pos, "label is negative: %v", x.Int)
+			return
+		}
+		tok.Arg = new(big.Int).Set(x.Int)
+	}
+}
+
+// parseLabelID parses a numbered label.
+func (p *parser) parseLabelID() *big.Int {
+	x := p.parseIntLit()
+	p.next()
+	return x
+}
+
+// parseInt parses a constant integer expression.
+func (p *parser) parseInt() *big.Int {
+	x := p.parseExpr()
+	if !p.checkInt(x) {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(x.Int)
+}
+
+func (p *parser) parseIntLit() *big.Int {
+	x, ok := new(big.Int).SetString(p.tok.lit, p.rules.intBase)
+	if !ok {
+		if !p.tok.bad {
+			p.errorf("invalid integer: %s", p.tok.lit)
+		}
+		return new(big.Int)
+	}
+	return x
+}
+
+func (p *parser) parseRuneLit() *big.Int {
+	lit := p.tok.lit
+	if p.tok.bad || len(lit) < 2 {
+		return new(big.Int)
+	}
+	r, _, _, err := strconv.UnquoteChar(lit[1:len(lit)-1], '\'')
+	if err != nil {
+		p.errorf("invalid character: %s", lit)
+		return new(big.Int)
+	}
+	return big.NewInt(int64(r))
+}
+
+// next advances to the next token from the innermost source that is
+// not exhausted.
+func (p *parser) next() {
+	p.prev = p.tok.end
+	for {
+		top := len(p.sources) - 1
+		it, ok := p.sources[top].next()
+		if ok || top == 0 {
+			p.tok = it
+			return
+		}
+		p.sources = p.sources[:top]
+	}
+}
+
+// push makes src the current source. The current token is replayed
+// once src is exhausted.
+func (p *parser) push(src source) {
+	p.sources = append(p.sources, &replaySource{items: []item{p.tok}}, src)
+	p.next()
+}
+
+func (p *parser) tokenString() string {
+	switch p.tok.tok {
+	case syntax.Ident, syntax.Int, syntax.Float, syntax.Rune, syntax.String:
+		return fmt.Sprintf("%s %s", p.tok.tok, p.tok.lit)
+	case syntax.Op:
+		return fmt.Sprintf("%s %s", p.tok.tok, p.tok.op)
+	case syntax.Lparen:
+		return "("
+	case syntax.Rparen:
+		return ")"
+	case syntax.Lbrace:
+		return "{"
+	case syntax.Rbrace:
+		return "}"
+	}
+	return p.tok.tok.String()
+}
+
+// syntaxPos converts a position to a syntax.Pos.
+func (p *parser) syntaxPos(pos token.Pos) syntax.Pos {
+	position := p.fset.Position(pos)
+	return syntax.MakePos(position.Filename, uint(position.Line), uint(position.Column))
+}
+
+func (p *parser) errorPos(pos syntax.Pos, msg string) {
+	if p.err == nil {
+		p.err = syntax.Error{Pos: pos, Msg: msg}
+	}
+}
+
+// errorf reports an error at the start of the current token.
+func (p *parser) errorf(format string, args ...interface{}) {
+	p.errorAt(p.tok.pos, format, args...)
+}
+
+// errorAt reports an error at a position.
+func (p *parser) errorAt(pos token.Pos, format string, args ...interface{}) {
+	p.errorPos(p.syntaxPos(pos), fmt.Sprintf(format, args...))
+}
+
+// errorAtToken reports an error at a token and the macro uses that it
+// was expanded from.
+func (p *parser) errorAtToken(tok *ws.Token, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	for exp := tok.Expansion; exp != nil; exp = exp.Parent {
+		msg += fmt.Sprintf(" (expanded from %v)", p.fset.Position(exp.Pos))
+	}
+	p.errorPos(p.syntaxPos(tok.Pos), msg)
 }
@@ -0,0 +1,354 @@
+package wsa
+
+import (
+	"fmt"
+	"go/token"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestParse(t *testing.T) {
+	src := `start:
+    push 'A'; printc # comment
+    push -0x10
+    copy 1
+    jz .done
+    call 3
+    jmp start
+3:
+    ret
+.done:
+    end
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tokens := program.Tokens
+	want := []*ws.Token{
+		{Type: ws.Label, Arg: big.NewInt(0), ArgString: "start"},
+		{Type: ws.Push, Arg: big.NewInt('A')},
+		{Type: ws.Printc},
+		{Type: ws.Push, Arg: big.NewInt(-16)},
+		{Type: ws.Copy, Arg: big.NewInt(1)},
+		{Type: ws.Jz, Arg: big.NewInt(1), ArgString: ".done"},
+		{Type: ws.Call, Arg: big.NewInt(3)},
+		{Type: ws.Jmp, Arg: big.NewInt(0), ArgString: "start"},
+		{Type: ws.Label, Arg: big.NewInt(3)},
+		{Type: ws.Ret},
+		{Type: ws.Label, Arg: big.NewInt(1), ArgString: ".done"},
+		{Type: ws.End},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		w := want[i]
+		if tok.Type != w.Type || tok.ArgString != w.ArgString ||
+			(tok.Arg == nil) != (w.Arg == nil) || tok.Arg != nil && tok.Arg.Cmp(w.Arg) != 0 {
+			t.Errorf("token %d: got %v (%v), want %v (%v)", i, tok, tok.Arg, w, w.Arg)
+		}
+	}
+
+	pos := program.Position(tokens[1].Pos)
+	end := program.Position(tokens[1].End)
+	if pos.Line != 2 || pos.Column != 5 || end.Line != 2 || end.Column != 13 {
+		t.Errorf("push position: got %v-%v, want 2:5-2:13", pos, end)
+	}
+}
+
+func TestParseDefine(t *testing.T) {
+	src := `define A 'a'-'A'
+define B (A+2)*-3 % 7
+define LOOP .loop; define ALIAS LOOP
+.loop:
+    push A; push B
+    jmp ALIAS
+    call 2*3
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tokens := program.Tokens
+	want := []string{".loop:", "push 32", "push 3", "jmp .loop", "call label_6"}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(tokens), len(want))
+	}
+	for i, tok := range tokens {
+		s := tok.String()
+		if tok.Type == ws.Label {
+			s += ":"
+		}
+		if s != want[i] {
+			t.Errorf("token %d: got %q, want %q", i, s, want[i])
+		}
+	}
+}
+
+func TestParseMacro(t *testing.T) {
+	src := `macro incr addr {
+    push addr; copy 0; retrieve
+    push 1; add; store
+}
+macro twice addr { incr addr; incr addr }
+define X 4
+    twice X+1
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"push 5", "copy 0", "retrieve", "push 1", "add", "store"}
+	if len(program.Tokens) != 2*len(want) {
+		t.Fatalf("got %d tokens, want %d", len(program.Tokens), 2*len(want))
+	}
+	for i, tok := range program.Tokens {
+		if s := tok.String(); s != want[i%len(want)] {
+			t.Errorf("token %d: got %q, want %q", i, s, want[i%len(want)])
+		}
+	}
+
+	tok := program.Tokens[len(want)]
+	if pos := program.Position(tok.Pos).String(); pos != "test.wsa:2:5" {
+		t.Errorf("token position: got %s, want test.wsa:2:5", pos)
+	}
+	exp := tok.Expansion
+	if exp == nil || exp.Name != "incr" || exp.Parent == nil || exp.Parent.Name != "twice" {
+		t.Fatalf("token expansion: got %v", exp)
+	}
+	if pos := program.Position(exp.Pos).String(); pos != "test.wsa:5:31" {
+		t.Errorf("incr use: got %s, want test.wsa:5:31", pos)
+	}
+	if pos := program.Position(exp.Parent.Pos).String(); pos != "test.wsa:7:5" {
+		t.Errorf("twice use: got %s, want test.wsa:7:5", pos)
+	}
+}
+
+func TestParseMacroLowerError(t *testing.T) {
+	src := `macro bad { copy -1 }
+    bad
+    end
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, errs := program.LowerIR()
+	want := "argument is negative: copy -1 at test.wsa:1:13 (expanded from test.wsa:2:5)"
+	if len(errs) == 0 || errs[0].Error() != want {
+		t.Errorf("got errors %v, want %s", errs, want)
+	}
+}
+
+func TestParseInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"main.wsa":      "include \"lib/io.wsa\"\n    newline\n    end\n",
+		"lib/io.wsa":    "define NL '\\n'\nmacro newline { push NL; printc }\ninclude \"extra.wsa\"\n",
+		"lib/extra.wsa": "    push 0\n",
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fset := token.NewFileSet()
+	main := filepath.Join(dir, "main.wsa")
+	program, err := Parse(fset, main, []byte(files["main.wsa"]))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"push 0", "push 10", "printc", "end"}
+	if len(program.Tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(program.Tokens), len(want))
+	}
+	for i, tok := range program.Tokens {
+		if s := tok.String(); s != want[i] {
+			t.Errorf("token %d: got %q, want %q", i, s, want[i])
+		}
+	}
+	if pos := fset.Position(program.Tokens[0].Pos); pos.Filename != filepath.Join(dir, "lib/extra.wsa") || pos.Line != 1 {
+		t.Errorf("included token position: got %v", pos)
+	}
+
+	files["lib/extra.wsa"] = "include \"../main.wsa\"\n"
+	ioutil.WriteFile(filepath.Join(dir, "lib/extra.wsa"), []byte(files["lib/extra.wsa"]), 0644)
+	_, err = Parse(token.NewFileSet(), main, []byte(files["main.wsa"]))
+	if want := filepath.Join(dir, "lib/extra.wsa") + ":1:9: include cycle: " + main; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestParseLocalLabels(t *testing.T) {
+	src := `f:
+    jmp .loop
+.loop:
+    jz .done
+.done:
+    ret
+g:
+    jmp .loop
+.loop:
+    call .only
+    ret
+h:
+.only:
+    ret
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"f:", "jmp f.loop", "f.loop:", "jz .done", ".done:", "ret",
+		"g:", "jmp g.loop", "g.loop:", "call .only", "ret", "h:", ".only:", "ret"}
+	if len(program.Tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(program.Tokens), len(want))
+	}
+	ids := make(map[string]string)
+	for i, tok := range program.Tokens {
+		s := tok.String()
+		if tok.Type == ws.Label {
+			s += ":"
+			if id, ok := ids[tok.Arg.String()]; ok {
+				t.Errorf("token %d: label ID %v reused from %s", i, tok.Arg, id)
+			}
+			ids[tok.Arg.String()] = s
+		}
+		if s != want[i] {
+			t.Errorf("token %d: got %q, want %q", i, s, want[i])
+		}
+	}
+	if program.Tokens[1].Arg.Cmp(program.Tokens[2].Arg) != 0 || program.Tokens[7].Arg.Cmp(program.Tokens[8].Arg) != 0 {
+		t.Errorf("local labels resolved to wrong scope")
+	}
+}
+
+func TestParseString(t *testing.T) {
+	src := `push "ab"
+printstr "\x41\n"
+storestr 2*5 "c"
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []struct {
+		Tok      string
+		Pos, End string
+	}{
+		{"push 98", "1:8", "1:9"},
+		{"push 97", "1:7", "1:8"},
+		{"push 65", "2:11", "2:15"},
+		{"printc", "2:11", "2:15"},
+		{"push 10", "2:15", "2:17"},
+		{"printc", "2:15", "2:17"},
+		{"push 10", "3:15", "3:16"},
+		{"push 99", "3:15", "3:16"},
+		{"store", "3:15", "3:16"},
+		{"push 11", "3:16", "3:17"},
+		{"push 0", "3:16", "3:17"},
+		{"store", "3:16", "3:17"},
+	}
+	if len(program.Tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d", len(program.Tokens), len(want))
+	}
+	for i, tok := range program.Tokens {
+		pos, end := program.Position(tok.Pos), program.Position(tok.End)
+		got := fmt.Sprintf("%d:%d", pos.Line, pos.Column)
+		gotEnd := fmt.Sprintf("%d:%d", end.Line, end.Column)
+		if tok.String() != want[i].Tok || got != want[i].Pos || gotEnd != want[i].End {
+			t.Errorf("token %d: got %s at %s-%s, want %s at %s-%s",
+				i, tok, got, gotEnd, want[i].Tok, want[i].Pos, want[i].End)
+		}
+	}
+}
+
+func TestParseAnnotations(t *testing.T) {
+	src := `define N 2
+@stack N -> 1
+@pure
+add2:
+    @assert s1 >= 0
+    @assert s0 != N*3
+    add
+    ret
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(program.Tokens) != 3 {
+		t.Fatalf("got %d tokens, want 3", len(program.Tokens))
+	}
+	meta := program.Tokens[0].Meta
+	if meta == nil || meta.Stack == nil || meta.Stack.String() != "2 -> 1" || !meta.Pure || meta.NoReturn {
+		t.Errorf("got label annotations %+v", meta)
+	}
+	if pos := program.Position(meta.Pos); pos.Line != 2 || pos.Column != 1 {
+		t.Errorf("got annotation position %v, want 2:1", pos)
+	}
+	asserts := program.Tokens[1].Asserts
+	if len(asserts) != 2 {
+		t.Fatalf("got %d assertions, want 2", len(asserts))
+	}
+	for i, want := range []string{"s1 ge 0", "s0 ne 6"} {
+		a := asserts[i]
+		if got := fmt.Sprintf("%v %v %v", a.Args[0], a.Op, a.Args[1]); got != want {
+			t.Errorf("assertion %d: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		Src, Err string
+	}{
+		{"push", "test.wsa:1:5: expected integer, found eof"},
+		{"foo 1", "test.wsa:1:1: unrecognized instruction: foo"},
+		{"  jmp -1", "test.wsa:1:7: label is negative: -1"},
+		{"push 1.5", "test.wsa:1:6: expected integer, found float 1.5"},
+		{"push X+1", "test.wsa:1:6: undefined: X"},
+		{"define X 1\ndefine X 2", "test.wsa:2:8: X redefined; previous definition at test.wsa:1:8"},
+		{"define L .loop\npush L*2", "test.wsa:2:6: L is a label, not an integer"},
+		{"push 1/(2-2)", "test.wsa:1:7: division by zero"},
+		{"push (1", "test.wsa:1:8: expected ), found eof"},
+		{"macro m {\npush 1", "test.wsa:2:7: unterminated macro m"},
+		{"macro push { }", "test.wsa:1:7: macro push conflicts with instruction"},
+		{"macro m { m }\nm", "test.wsa:1:11: recursive expansion of macro m"},
+		{"macro m x { push x }\nm", "test.wsa:2:2: expected integer, found eof"},
+		{"macro m { push y }\nm", "test.wsa:1:16: undefined: y"},
+		{"jmp .x", "test.wsa:1:1: undefined label: .x"},
+		{"macro m { jmp x }\nm", "test.wsa:1:11: undefined label: x (expanded from test.wsa:2:1)"},
+		{"a:\n.x:\nb:\n.x:\nc:\njmp .x", "test.wsa:6:1: ambiguous label: .x declared in 2 scopes"},
+		{"a:\na:\nend", "test.wsa:2:1: label a redefined; previous definition at test.wsa:1:1"},
+		{"a:\n.x:\n.x:\nend", "test.wsa:3:1: label .x redefined; previous definition at test.wsa:2:1"},
+		{"printstr 'a'", "test.wsa:1:10: expected string, found rune 'a'"},
+		{"storestr 0 \"a\\q\"", "test.wsa:1:15: unknown escape"},
+		{"@inline\nf:", "test.wsa:1:1: unknown annotation: @inline"},
+		{"@pure\npush 1", "test.wsa:1:1: annotation must precede a label"},
+		{"@stack 1 2\nf:", "test.wsa:1:10: expected ->, found int 2"},
+		{"@stack -1 -> 0\nf:", "test.wsa:1:8: integer out of range: -1"},
+		{"@assert s0\nend", "test.wsa:2:1: expected comparison, found ident end"},
+		{"end\n@assert s0 < 1", "test.wsa:2:1: assertion must precede an instruction"},
+	}
+	for i, test := range tests {
+		_, err := Parse(token.NewFileSet(), "test.wsa", []byte(test.Src))
+		if err == nil || err.Error() != test.Err {
+			t.Errorf("test %d: got error %v, want %s", i+1, err, test.Err)
+		}
+	}
+}
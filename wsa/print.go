@@ -0,0 +1,264 @@
+package wsa
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/andrewarchi/nebula/syntax"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// Printer formats programs as assembly.
+type Printer struct {
+	Dialect     Dialect // Output dialect; Auto formats as Nebula
+	Indent      string  // Indentation of instructions
+	FoldStrings bool    // Fold character sequences into string pseudo-instructions
+}
+
+// Dump formats a program as assembly in the given dialect, so that it
+// can be assembled by that dialect's assembler.
+func Dump(p *ws.Program, d Dialect, indent string) (string, error) {
+	pr := &Printer{Dialect: d, Indent: indent}
+	return pr.Dump(p)
+}
+
+// Dump formats a program as assembly. Characters pushed for printing
+// are formatted as character literals, when the dialect has them. An
+// error is returned when the program uses an instruction that the
+// dialect lacks.
+func (pr *Printer) Dump(p *ws.Program) (string, error) {
+	d := pr.Dialect
+	if d == Auto {
+		d = Nebula
+	}
+	if int(d) >= len(dialects) {
+		return "", fmt.Errorf("wsa: invalid dialect: %v", d)
+	}
+	r := dialects[d]
+	var b strings.Builder
+	for i := 0; i < len(p.Tokens); i++ {
+		tok := p.Tokens[i]
+		pr.dumpAnnotations(&b, tok)
+		if tok.Type == ws.Label {
+			if r.colonLabels {
+				b.WriteString(r.formatLabel(tok))
+				b.WriteString(":\n")
+			} else {
+				fmt.Fprintf(&b, "label %s\n", r.formatLabel(tok))
+			}
+			continue
+		}
+		if pr.FoldStrings {
+			j := i + 1
+			for j < len(p.Tokens) && p.Tokens[j].Meta == nil && p.Tokens[j].Asserts == nil {
+				j++
+			}
+			if s, n := r.foldString(p.Tokens[i:j]); n != 0 {
+				b.WriteString(pr.Indent)
+				b.WriteString(s)
+				b.WriteByte('\n')
+				i += n - 1
+				continue
+			}
+		}
+		name, ok := r.mnemonic(tok.Type)
+		if !ok {
+			return "", fmt.Errorf("wsa: %s dialect has no %s instruction at %v", d, tok.Type, p.Position(tok.Pos))
+		}
+		b.WriteString(pr.Indent)
+		b.WriteString(name)
+		if tok.Type.HasArg() {
+			b.WriteByte(' ')
+			if tok.Type.IsControl() {
+				b.WriteString(r.formatLabel(tok))
+			} else if tok.Type == ws.Push && i+1 < len(p.Tokens) && p.Tokens[i+1].Type == ws.Printc {
+				b.WriteString(r.formatChar(tok.Arg))
+			} else {
+				b.WriteString(tok.Arg.String())
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// dumpAnnotations formats the annotations of a token on the lines
+// before it.
+func (pr *Printer) dumpAnnotations(b *strings.Builder, tok *ws.Token) {
+	if meta := tok.Meta; meta != nil {
+		if meta.Stack != nil {
+			fmt.Fprintf(b, "@stack %d -> %d\n", meta.Stack.Pops, meta.Stack.Pushes)
+		}
+		if meta.Pure {
+			b.WriteString("@pure\n")
+		}
+		if meta.NoReturn {
+			b.WriteString("@noreturn\n")
+		}
+	}
+	for _, assert := range tok.Asserts {
+		op := syntax.Operator(0)
+		for sop, cop := range cmpOps {
+			if cop == assert.Op {
+				op = sop
+			}
+		}
+		fmt.Fprintf(b, "%s@assert %v %v %v\n", pr.Indent, assert.Args[0], op, assert.Args[1])
+	}
+}
+
+// foldString folds the longest character sequence at the start of
+// tokens into a string pseudo-instruction, trying storestr, printstr,
+// then push, and returns it with the number of tokens folded. Zero is
+// returned when no sequence of at least two characters is found.
+func (r *syntaxRules) foldString(tokens []*ws.Token) (string, int) {
+	if r.pseudoInsts {
+		if s, n := foldStoreStr(tokens); n != 0 {
+			return s, n
+		}
+		if s, n := foldPrintStr(tokens); n != 0 {
+			return s, n
+		}
+	}
+	if r.pushStrings {
+		return foldPushStr(tokens)
+	}
+	return "", 0
+}
+
+// foldStoreStr folds "push addr+i; push c; store" sequences ending
+// with a 0 terminator.
+func foldStoreStr(tokens []*ws.Token) (string, int) {
+	if len(tokens) < 3 || !isPush(tokens[0]) {
+		return "", 0
+	}
+	addr := tokens[0].Arg
+	var chars []rune
+	for i := 0; i+2 < len(tokens); i += 3 {
+		t := tokens[i : i+3]
+		if !isPush(t[0]) || !isPush(t[1]) || t[2].Type != ws.Store ||
+			new(big.Int).Sub(t[0].Arg, addr).Cmp(big.NewInt(int64(len(chars)))) != 0 {
+			break
+		}
+		if t[1].Arg.Sign() == 0 {
+			if len(chars) < 2 {
+				break
+			}
+			return fmt.Sprintf("storestr %s %s", addr, strconv.Quote(string(chars))), i + 3
+		}
+		c, ok := charArg(t[1])
+		if !ok {
+			break
+		}
+		chars = append(chars, c)
+	}
+	return "", 0
+}
+
+// foldPrintStr folds "push c; printc" sequences.
+func foldPrintStr(tokens []*ws.Token) (string, int) {
+	var chars []rune
+	for i := 0; i+1 < len(tokens) && tokens[i+1].Type == ws.Printc; i += 2 {
+		c, ok := charArg(tokens[i])
+		if !ok {
+			break
+		}
+		chars = append(chars, c)
+	}
+	if len(chars) < 2 {
+		return "", 0
+	}
+	return "printstr " + strconv.Quote(string(chars)), 2 * len(chars)
+}
+
+// foldPushStr folds pushes of characters, which are pushed in reverse.
+// Pushes that are immediately consumed by printc or store are left
+// unfolded.
+func foldPushStr(tokens []*ws.Token) (string, int) {
+	var chars []rune
+	for _, tok := range tokens {
+		c, ok := charArg(tok)
+		if !ok {
+			break
+		}
+		chars = append(chars, c)
+	}
+	n := len(chars)
+	if n < len(tokens) {
+		switch tokens[n].Type {
+		case ws.Printc:
+			n--
+		case ws.Store:
+			n -= 2
+		}
+	}
+	if n < 2 {
+		return "", 0
+	}
+	chars = chars[:n]
+	for i, j := 0, len(chars)-1; i < j; i, j = i+1, j-1 {
+		chars[i], chars[j] = chars[j], chars[i]
+	}
+	return "push " + strconv.Quote(string(chars)), len(chars)
+}
+
+func isPush(tok *ws.Token) bool {
+	return tok.Type == ws.Push && tok.Arg != nil
+}
+
+// charArg returns the argument of a push as a character, when it is
+// printable or a common escape.
+func charArg(tok *ws.Token) (rune, bool) {
+	if !isPush(tok) || !tok.Arg.IsInt64() {
+		return 0, false
+	}
+	c := tok.Arg.Int64()
+	if c > utf8.MaxRune {
+		return 0, false
+	}
+	r := rune(c)
+	return r, unicode.IsPrint(r) || r == '\n' || r == '\t'
+}
+
+// formatLabel formats the label argument of a control flow token.
+// Label names are kept when the dialect can represent them.
+func (r *syntaxRules) formatLabel(tok *ws.Token) string {
+	if r.numLabels {
+		return tok.Arg.String()
+	}
+	if tok.ArgString != "" && (r == dialects[Nebula] || isIdent(tok.ArgString)) {
+		return tok.ArgString
+	}
+	return fmt.Sprintf("label_%s", tok.Arg)
+}
+
+// formatChar formats an integer as a character literal when it is a
+// printable ASCII character that the dialect can represent, otherwise
+// as an integer.
+func (r *syntaxRules) formatChar(x *big.Int) string {
+	if x.IsInt64() {
+		c := x.Int64()
+		switch {
+		case r.charIdents && ('A' <= c && c <= 'Z' || 'a' <= c && c <= 'z'):
+			return string(rune(c))
+		case r.charLits && ' ' <= c && c <= '~':
+			return strconv.QuoteRuneToASCII(rune(c))
+		}
+	}
+	return x.String()
+}
+
+// isIdent reports whether s is a plain identifier that any dialect
+// accepts as a label name.
+func isIdent(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || i != 0 && '0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return s != "" && !isInst(s) && !isDirective(s)
+}
@@ -0,0 +1,85 @@
+package wsa
+
+import (
+	"go/token"
+	"testing"
+
+	"github.com/andrewarchi/nebula/ws"
+)
+
+func TestDump(t *testing.T) {
+	src := `start:
+    push 'H'; printc
+    push -1; jn .exit
+    readi; jmp start
+.exit:
+    end
+`
+	tests := []struct {
+		Dialect Dialect
+		Want    string
+	}{
+		{Nebula, "start:\n    push 72\n    printc\n    push -1\n    jn .exit\n    readi\n    jmp start\n.exit:\n    end\n"},
+		{Whitelips, "start:\n    push 'H'\n    printc\n    push -1\n    jn label_1\n    readi\n    jmp start\nlabel_1:\n    end\n"},
+		{Burghard, "label start\n    push 72\n    outC\n    push -1\n    jumpn label_1\n    inN\n    jump start\nlabel label_1\n    exit\n"},
+		{Rosetta, "0:\n    push H\n    ochr\n    push -1\n    jn 1\n    inum\n    jump 0\n1:\n    exit\n"},
+	}
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, test := range tests {
+		got, err := Dump(program, test.Dialect, "    ")
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Dialect, err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("%v: got:\n%s\nwant:\n%s", test.Dialect, got, test.Want)
+		}
+		dumped, err := ParseDialect(token.NewFileSet(), "dump.wsa", []byte(got), test.Dialect)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", test.Dialect, err)
+			continue
+		}
+		if dumped.DumpWS() != program.DumpWS() {
+			t.Errorf("%v: reassembled program differs", test.Dialect)
+		}
+	}
+
+	program.Tokens[0].Type = ws.Shuffle
+	want := "wsa: whitelips dialect has no shuffle instruction at test.wsa:1:1"
+	if _, err := Dump(program, Whitelips, "    "); err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %s", err, want)
+	}
+}
+
+func TestDumpFoldStrings(t *testing.T) {
+	src := `    storestr 8 "ab\n"
+    printstr "Hi!"
+    push "xyz"
+    push 'q'; printc
+    push 1; push 'c'; store
+`
+	want := `    storestr 8 "ab\n"
+    printstr "Hi!"
+    push "xyz"
+    push 113
+    printc
+    push 1
+    push 99
+    store
+`
+	program, err := Parse(token.NewFileSet(), "test.wsa", []byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pr := &Printer{Dialect: Nebula, Indent: "    ", FoldStrings: true}
+	got, err := pr.Dump(program)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
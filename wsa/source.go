@@ -0,0 +1,81 @@
+package wsa
+
+import (
+	"bytes"
+	"go/token"
+
+	"github.com/andrewarchi/nebula/syntax"
+)
+
+// item is a scanned token with its position.
+type item struct {
+	tok  syntax.Token
+	lit  string
+	op   syntax.Operator
+	bad  bool
+	pos  token.Pos
+	end  token.Pos
+	exp  *expansion // Macro expansion replaying this token, if any
+	file *token.File
+}
+
+// source produces items for the parser.
+type source interface {
+	// next returns the next item and false when the source is
+	// exhausted.
+	next() (item, bool)
+}
+
+// fileSource scans items from a source file.
+type fileSource struct {
+	*syntax.Scanner
+	file *token.File
+}
+
+func newFileSource(file *token.File, src []byte, mode uint, errh func(pos syntax.Pos, msg string)) *fileSource {
+	file.SetLinesForContent(src)
+	s := &fileSource{file: file}
+	s.Scanner = syntax.NewScanner(bytes.NewReader(src), func(line, col uint, msg string) {
+		errh(syntax.MakePos(file.Name(), line, col), msg)
+	}, mode)
+	return s
+}
+
+func (s *fileSource) next() (item, bool) {
+	s.Next()
+	it := item{
+		tok:  s.Token(),
+		lit:  s.Literal(),
+		op:   s.Op(),
+		bad:  s.Bad(),
+		pos:  s.posAt(s.Pos()),
+		end:  s.posAt(s.End()),
+		file: s.file,
+	}
+	return it, it.tok != syntax.EOF
+}
+
+func (s *fileSource) posAt(line, col uint) token.Pos {
+	if line == 0 || int(line) > s.file.LineCount() {
+		return token.NoPos
+	}
+	return s.file.LineStart(int(line)) + token.Pos(col-1)
+}
+
+// replaySource replays previously scanned items, such as a macro body.
+type replaySource struct {
+	items []item
+	exp   *expansion
+}
+
+func (s *replaySource) next() (item, bool) {
+	if len(s.items) == 0 {
+		return item{}, false
+	}
+	it := s.items[0]
+	s.items = s.items[1:]
+	if s.exp != nil {
+		it.exp = s.exp
+	}
+	return it, true
+}
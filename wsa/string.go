@@ -0,0 +1,105 @@
+package wsa
+
+import (
+	"go/token"
+	"math/big"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/andrewarchi/nebula/syntax"
+	"github.com/andrewarchi/nebula/ws"
+)
+
+// char is a character in a string literal with its source span.
+type char struct {
+	r        rune
+	pos, end token.Pos
+}
+
+// parseStringLit parses a string literal into characters, each
+// positioned at its source text within the literal.
+func (p *parser) parseStringLit() ([]char, bool) {
+	if p.tok.tok != syntax.String {
+		p.errorf("expected string, found %s", p.tokenString())
+		return nil, false
+	}
+	lit, pos := p.tok.lit, p.tok.pos
+	if p.tok.bad || len(lit) < 2 {
+		p.next()
+		return nil, false
+	}
+	var chars []char
+	if lit[0] == '`' {
+		for i, r := range lit[1 : len(lit)-1] {
+			start := pos + token.Pos(1+i)
+			chars = append(chars, char{r, start, start + token.Pos(utf8.RuneLen(r))})
+		}
+	} else {
+		body := lit[1 : len(lit)-1]
+		for s := body; len(s) != 0; {
+			r, _, tail, err := strconv.UnquoteChar(s, '"')
+			if err != nil {
+				p.errorAt(pos+token.Pos(1+len(body)-len(s)), "invalid string: %s", lit)
+				p.next()
+				return nil, false
+			}
+			start := pos + token.Pos(1+len(body)-len(s))
+			end := pos + token.Pos(1+len(body)-len(tail))
+			chars = append(chars, char{r, start, end})
+			s = tail
+		}
+	}
+	p.next()
+	return chars, true
+}
+
+// parsePushString parses a string argument to push, which pushes each
+// character in reverse, so that the first character is on top.
+func (p *parser) parsePushString(exp *expansion) {
+	chars, _ := p.parseStringLit()
+	for i := len(chars) - 1; i >= 0; i-- {
+		p.appendChar(ws.Push, chars[i].r, chars[i], exp)
+	}
+}
+
+// parseStringInst parses a string pseudo-instruction:
+//
+//	printstr "text"       prints each character of text
+//	storestr addr "text"  stores text at addr, followed by a 0 terminator
+func (p *parser) parseStringInst(name string, exp *expansion) {
+	switch name {
+	case "printstr":
+		chars, _ := p.parseStringLit()
+		for _, c := range chars {
+			p.appendChar(ws.Push, c.r, c, exp)
+			p.appendChar(ws.Printc, 0, c, exp)
+		}
+	case "storestr":
+		addr := p.parseInt()
+		end := p.tok.end
+		chars, ok := p.parseStringLit()
+		if !ok {
+			return
+		}
+		for i, c := range chars {
+			p.appendStore(new(big.Int).Add(addr, big.NewInt(int64(i))), c.r, c, exp)
+		}
+		// Terminator is positioned at the closing quote
+		n := big.NewInt(int64(len(chars)))
+		p.appendStore(n.Add(addr, n), 0, char{pos: end - 1, end: end}, exp)
+	}
+}
+
+func (p *parser) appendStore(addr *big.Int, r rune, c char, exp *expansion) {
+	p.appendToken(&ws.Token{Type: ws.Push, Arg: addr, Pos: c.pos, End: c.end}, exp)
+	p.appendChar(ws.Push, r, c, exp)
+	p.appendChar(ws.Store, 0, c, exp)
+}
+
+func (p *parser) appendChar(typ ws.Type, r rune, c char, exp *expansion) {
+	tok := &ws.Token{Type: typ, Pos: c.pos, End: c.end}
+	if typ.HasArg() {
+		tok.Arg = big.NewInt(int64(r))
+	}
+	p.appendToken(tok, exp)
+}